@@ -0,0 +1,202 @@
+package bmff
+
+import (
+	"fmt"
+)
+
+// AudioSpecificConfig is the MPEG-4 audio configuration (ISO/IEC 14496-3 1.6.2.1) carried
+// as the decoder specific info of an mp4a entry's esds
+type AudioSpecificConfig struct {
+	ObjectType             uint8 // of the core coder, e.g. 2 for AAC-LC even when SBR is added
+	SamplingFrequencyIndex uint8
+	SamplingFrequency      uint32 // of the core coder
+	ChannelConfiguration   uint8  // 0 when a program config element gives the channels
+	Channels               int    // 0 when unknown
+	FrameLengthFlag        bool   // 960 rather than 1024 samples per frame, for the AAC object types
+
+	// SBR and PS, signalled either by the object type (5 or 29) or by a sync extension
+	ExtensionObjectType        uint8 // 5 when SBR is present
+	SBRPresent                 bool
+	PSPresent                  bool
+	ExtensionSamplingFrequency uint32 // output rate with SBR, normally twice SamplingFrequency
+}
+
+// MPEG-4 audio object types
+const (
+	AACObjectMain = 1
+	AACObjectLC   = 2
+	AACObjectSSR  = 3
+	AACObjectLTP  = 4
+	AACObjectSBR  = 5
+	AACObjectPS   = 29
+)
+
+// Profile names the configuration: "AAC-LC", "HE-AAC", "HE-AACv2" and so on
+func (a *AudioSpecificConfig) Profile() string {
+	switch {
+	case a.ObjectType == AACObjectLC && a.PSPresent:
+		return "HE-AACv2"
+	case a.ObjectType == AACObjectLC && a.SBRPresent:
+		return "HE-AAC"
+	}
+	switch a.ObjectType {
+	case AACObjectMain:
+		return "AAC Main"
+	case AACObjectLC:
+		return "AAC-LC"
+	case AACObjectSSR:
+		return "AAC SSR"
+	case AACObjectLTP:
+		return "AAC LTP"
+	}
+	return fmt.Sprintf("audio object type %d", a.ObjectType)
+}
+
+// SampleRate returns the rate of the decoded output: the SBR rate when SBR is present
+func (a *AudioSpecificConfig) SampleRate() uint32 {
+	if a.SBRPresent && a.ExtensionSamplingFrequency != 0 {
+		return a.ExtensionSamplingFrequency
+	}
+	return a.SamplingFrequency
+}
+
+var aacSampleRates = [...]uint32{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// channels of channelConfiguration 1 to 14, 0 for reserved values
+var aacChannels = [...]int{0, 1, 2, 3, 4, 5, 6, 8, 0, 0, 0, 7, 8, 24, 8}
+
+const (
+	aacSyncExtensionSBR = 0x2b7
+	aacSyncExtensionPS  = 0x548
+)
+
+// ParseAudioSpecificConfig decodes an AudioSpecificConfig
+func ParseAudioSpecificConfig(data []byte) (*AudioSpecificConfig, error) {
+	r := newBitReader(data)
+	a := &AudioSpecificConfig{}
+	a.ObjectType = aacObjectType(r)
+	a.SamplingFrequencyIndex, a.SamplingFrequency = aacSamplingFrequency(r)
+	a.ChannelConfiguration = uint8(r.U(4))
+	if int(a.ChannelConfiguration) < len(aacChannels) {
+		a.Channels = aacChannels[a.ChannelConfiguration]
+	}
+	if a.ObjectType == AACObjectSBR || a.ObjectType == AACObjectPS {
+		// hierarchical signalling: the extension comes first, then the core
+		a.ExtensionObjectType = AACObjectSBR
+		a.SBRPresent = true
+		a.PSPresent = a.ObjectType == AACObjectPS
+		_, a.ExtensionSamplingFrequency = aacSamplingFrequency(r)
+		a.ObjectType = aacObjectType(r)
+		if a.ObjectType == 22 { // ER BSAC
+			r.Skip(4) // extensionChannelConfiguration
+		}
+	}
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	switch a.ObjectType {
+	case 1, 2, 3, 4, 6, 7, 17, 19, 20, 21, 22, 23:
+		if err := a.parseGASpecificConfig(r); err != nil {
+			return nil, err
+		}
+	default:
+		// nothing more is needed from the other object types
+		return a, nil
+	}
+	switch a.ObjectType {
+	case 17, 19, 20, 21, 22, 23:
+		r.Skip(2) // epConfig
+	}
+	// backward compatible explicit signalling of SBR and PS, after the core config
+	if a.ExtensionObjectType != AACObjectSBR && r.Remaining() >= 16 && r.U(11) == aacSyncExtensionSBR {
+		if ext := aacObjectType(r); ext == AACObjectSBR {
+			a.ExtensionObjectType = ext
+			a.SBRPresent = r.Flag()
+			if a.SBRPresent {
+				_, a.ExtensionSamplingFrequency = aacSamplingFrequency(r)
+				if r.Remaining() >= 12 && r.U(11) == aacSyncExtensionPS {
+					a.PSPresent = r.Flag()
+				}
+			}
+		}
+	}
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	return a, nil
+}
+
+// aacObjectType reads GetAudioObjectType()
+func aacObjectType(r *bitReader) uint8 {
+	t := r.U(5)
+	if t == 31 {
+		t = 32 + r.U(6)
+	}
+	return uint8(t)
+}
+
+// aacSamplingFrequency reads a samplingFrequencyIndex and, for index 15, the explicit rate
+func aacSamplingFrequency(r *bitReader) (uint8, uint32) {
+	idx := uint8(r.U(4))
+	switch {
+	case idx == 0xf:
+		return idx, r.U(24)
+	case int(idx) < len(aacSampleRates):
+		return idx, aacSampleRates[idx]
+	}
+	return idx, 0
+}
+
+// parseGASpecificConfig reads the GASpecificConfig of the AAC object types
+func (a *AudioSpecificConfig) parseGASpecificConfig(r *bitReader) error {
+	a.FrameLengthFlag = r.Flag()
+	if r.Flag() { // dependsOnCoreCoder
+		r.Skip(14) // coreCoderDelay
+	}
+	extension := r.Flag()
+	if a.ChannelConfiguration == 0 {
+		a.Channels = parseAACProgramConfig(r)
+	}
+	if a.ObjectType == 6 || a.ObjectType == 20 {
+		r.Skip(3) // layerNr
+	}
+	if extension {
+		switch a.ObjectType {
+		case 22:
+			r.Skip(16) // numOfSubFrame, layer_length
+		case 17, 19, 20, 23:
+			r.Skip(3) // resilience flags
+		}
+		r.Skip(1) // extensionFlag3
+	}
+	return r.Err()
+}
+
+// parseAACProgramConfig reads a program_config_element() and returns its channel count
+func parseAACProgramConfig(r *bitReader) int {
+	r.Skip(10) // element_instance_tag, object_type, sampling_frequency_index
+	front, side, back := int(r.U(4)), int(r.U(4)), int(r.U(4))
+	lfe, assoc, cc := int(r.U(2)), int(r.U(3)), int(r.U(4))
+	if r.Flag() { // mono_mixdown_present
+		r.Skip(4)
+	}
+	if r.Flag() { // stereo_mixdown_present
+		r.Skip(4)
+	}
+	if r.Flag() { // matrix_mixdown_idx_present
+		r.Skip(3)
+	}
+	channels := lfe
+	for i := 0; i < front+side+back && r.Err() == nil; i++ {
+		if r.Flag() { // is_cpe: a channel pair
+			channels += 2
+		} else {
+			channels++
+		}
+		r.Skip(4) // element tag
+	}
+	r.Skip(4*lfe + 4*assoc + 5*cc)
+	r.Skip((8 - r.pos%8) % 8) // byte_alignment
+	r.Skip(8 * int(r.U(8)))   // comment_field_data
+	return channels
+}
@@ -0,0 +1,153 @@
+package bmff
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseAudioSpecificConfig(t *testing.T) {
+	bits := func(fill func(w *bitWriter)) []byte {
+		w := &bitWriter{}
+		fill(w)
+		return w.buf
+	}
+	tests := []struct {
+		name         string
+		asc          []byte
+		wantProfile  string
+		wantRate     uint32 // output rate
+		wantCoreRate uint32
+		wantChannels int
+		wantErr      error
+	}{
+		{"AAC-LC 44.1kHz stereo", []byte{0x12, 0x10}, "AAC-LC", 44100, 44100, 2, nil},
+		{"HE-AAC hierarchical", bits(func(w *bitWriter) {
+			w.u(5, 5).u(4, 6).u(4, 2).u(4, 3).u(5, 2).u(3, 0)
+		}), "HE-AAC", 48000, 24000, 2, nil},
+		{"HE-AACv2 hierarchical", bits(func(w *bitWriter) {
+			w.u(5, 29).u(4, 6).u(4, 1).u(4, 3).u(5, 2).u(3, 0)
+		}), "HE-AACv2", 48000, 24000, 1, nil},
+		{"HE-AACv2 explicit", bits(func(w *bitWriter) {
+			w.u(5, 2).u(4, 7).u(4, 1).u(3, 0)
+			w.u(11, 0x2b7).u(5, 5).flag(true).u(4, 4).u(11, 0x548).flag(true)
+		}), "HE-AACv2", 44100, 22050, 1, nil},
+		{"explicit sync extension without SBR", bits(func(w *bitWriter) {
+			w.u(5, 2).u(4, 3).u(4, 2).u(3, 0)
+			w.u(11, 0x2b7).u(5, 5).flag(false)
+		}), "AAC-LC", 48000, 48000, 2, nil},
+		{"escaped sampling frequency", bits(func(w *bitWriter) {
+			w.u(5, 2).u(4, 15).u(24, 37800).u(4, 1).u(3, 0)
+		}), "AAC-LC", 37800, 37800, 1, nil},
+		{"5.1 from a program config element", bits(func(w *bitWriter) {
+			w.u(5, 2).u(4, 3).u(4, 0).u(3, 0)
+			// PCE: front SCE and CPE, back CPE, one LFE
+			w.u(4, 0).u(2, 1).u(4, 3).u(4, 2).u(4, 0).u(4, 1).u(2, 1).u(3, 0).u(4, 0)
+			w.flag(false).flag(false).flag(false)
+			w.flag(false).u(4, 0).flag(true).u(4, 0).flag(true).u(4, 1).u(4, 0)
+			for w.n%8 != 0 {
+				w.u(1, 0)
+			}
+			w.u(8, 2).u(16, 0x6869)
+		}), "AAC-LC", 48000, 48000, 6, nil},
+		{"escaped object type", bits(func(w *bitWriter) {
+			w.u(5, 31).u(6, 4).u(4, 3).u(4, 2)
+		}), "audio object type 36", 48000, 48000, 2, nil},
+		{"truncated", []byte{0x12}, "", 0, 0, 0, ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asc, err := ParseAudioSpecificConfig(tt.asc)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAudioSpecificConfig() error = %v", err)
+			}
+			if asc.Profile() != tt.wantProfile || asc.SampleRate() != tt.wantRate || asc.SamplingFrequency != tt.wantCoreRate ||
+				asc.Channels != tt.wantChannels {
+				t.Errorf("got %s %d Hz (core %d) %d channels, want %s %d Hz (core %d) %d channels", asc.Profile(), asc.SampleRate(),
+					asc.SamplingFrequency, asc.Channels, tt.wantProfile, tt.wantRate, tt.wantCoreRate, tt.wantChannels)
+			}
+		})
+	}
+}
+
+func TestEsds(t *testing.T) {
+	// ES_Descriptor with a dependency and a URL, sizes coded in 4 bytes as some writers do
+	dsi := []byte{0x05, 0x80, 0x80, 0x80, 0x02, 0x13, 0x90}
+	dcd := append([]byte{0x04, 0x80, 0x80, 0x80, byte(13 + len(dsi)), 0x40, 0x15, 0, 0x01, 0x2c, 0, 0, 0xa2, 0xf0, 0, 0, 0x90, 0xd0}, dsi...)
+	sl := []byte{0x06, 0x01, 0x02}
+	body := append([]byte{0, 1, 0xc0, 0, 2, 3, 'a', 'b', 'c'}, dcd...)
+	body = append(body, sl...)
+	esds := append([]byte{0, 0, 0, 0, 0x03, byte(len(body))}, body...)
+
+	tests := []struct {
+		name    string
+		esds    []byte
+		wantErr error
+	}{
+		{"ES with URL and dependency", esds, nil},
+		{"not an ES_Descriptor", []byte{0, 0, 0, 0, 0x04, 0}, ErrBadValue},
+		{"descriptor overruns the box", esds[:len(esds)-4], ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audio := make([]byte, 28)
+			audio[17], audio[19], audio[24], audio[25] = 2, 16, 0x5d, 0xc0
+			data := mkStbl(mkStsd(mkBox("mp4a", audio, mkBox("esds", tt.esds))))
+			f, _, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{Strict: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			e := f.Moov.TrackBoxes[0].Mdia.Minf.Stbl.Stsd.Entries[0].(*AudioSampleEntry).Esds
+			if e == nil || e.ES.ESID != 1 || e.ES.DependsOnESID != 2 || e.ES.URL != "abc" || e.ES.SLConfig.Predefined != 2 {
+				t.Fatalf("esds = %+v", e)
+			}
+			if dc := e.ES.DecoderConfig; dc.StreamType != 5 || dc.AvgBitrate != 37072 || dc.MaxBitrate != 41712 {
+				t.Errorf("decoder config = %+v", dc)
+			}
+			if asc, err := e.AudioSpecificConfig(); err != nil || asc.Profile() != "AAC-LC" || asc.SampleRate() != 22050 {
+				t.Errorf("AudioSpecificConfig() = %+v, error %v", asc, err)
+			}
+		})
+	}
+}
+
+func TestEsdsFile(t *testing.T) {
+	fh, err := os.Open(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer fh.Close()
+	f, err := Parse(fh)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	sound, ok := f.FindFirst("moov/trak[hdlr=soun]/mdia/minf/stbl/stsd/mp4a").(*AudioSampleEntry)
+	if !ok || sound.Esds == nil {
+		t.Fatalf("no esds in the mp4a entry")
+	}
+	asc, err := sound.Esds.AudioSpecificConfig()
+	if err != nil || asc.Profile() != "AAC-LC" || asc.SampleRate() != 22050 || asc.Channels != 2 {
+		t.Errorf("AudioSpecificConfig() = %+v, error %v", asc, err)
+	}
+	video, ok := f.FindFirst("moov/trak[hdlr=vide]/mdia/minf/stbl/stsd/mp4v").(*VisualSampleEntry)
+	if !ok || video.Esds == nil || video.Esds.ES.DecoderConfig.ObjectTypeIndication != 0x20 {
+		t.Fatalf("mp4v esds = %+v", video.Esds)
+	}
+	if _, err := video.Esds.AudioSpecificConfig(); !errors.Is(err, ErrBadValue) {
+		t.Errorf("AudioSpecificConfig() of a video stream: error %v", err)
+	}
+}
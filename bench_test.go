@@ -0,0 +1,55 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// mkFragmentedFile builds an init segment followed by n fragments, each a moof with
+// one traf (tfhd, tfdt and a trun of samples sample records) and its mdat
+func mkFragmentedFile(n, samples int) []byte {
+	var data []byte
+	data = append(data, mkBox("ftyp", []byte("iso6"), make([]byte, 4), []byte("iso6"))...)
+	data = append(data, mkBox("moov", mkBox("mvhd", make([]byte, 100)))...)
+	tfhd := make([]byte, 8)
+	binary.BigEndian.PutUint32(tfhd[4:8], 1)
+	trun := make([]byte, 8+8*samples)
+	trun[2] = 0x03 // sample duration and size present
+	binary.BigEndian.PutUint32(trun[4:8], uint32(samples))
+	for i := 0; i < n; i++ {
+		mfhd := make([]byte, 8)
+		binary.BigEndian.PutUint32(mfhd[4:8], uint32(i+1))
+		tfdt := make([]byte, 8)
+		binary.BigEndian.PutUint32(tfdt[4:8], uint32(i*samples))
+		moof := mkBox("moof", mkBox("mfhd", mfhd),
+			mkBox("traf", mkBox("tfhd", tfhd), mkBox("tfdt", tfdt), mkBox("trun", trun)))
+		data = append(data, moof...)
+		data = append(data, mkBox("mdat", make([]byte, 64))...)
+	}
+	return data
+}
+
+func BenchmarkParseFragmented(b *testing.B) {
+	data := mkFragmentedFile(5000, 30)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f, err := Parse(bytes.NewReader(data))
+		if err != nil || len(f.Fragments) != 5000 {
+			b.Fatalf("Parse() = %d fragments, error %v", len(f.Fragments), err)
+		}
+	}
+}
+
+func BenchmarkParseReaderAtFragmented(b *testing.B) {
+	data := mkFragmentedFile(5000, 30)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f, err := ParseReaderAt(bytes.NewReader(data), int64(len(data)))
+		if err != nil || len(f.Fragments) != 5000 {
+			b.Fatalf("ParseReaderAt() = %d fragments, error %v", len(f.Fragments), err)
+		}
+	}
+}
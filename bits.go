@@ -0,0 +1,104 @@
+package bmff
+
+import (
+	"fmt"
+)
+
+// bitReader reads the bit fields and Exp-Golomb codes of codec parameter sets,
+// most significant bit first.  Like cursor, the first read past the end sets a sticky
+// ErrTruncated error and every later read returns zero.
+type bitReader struct {
+	buf []byte
+	pos int // in bits
+	err error
+}
+
+func newBitReader(buf []byte) *bitReader {
+	return &bitReader{buf: buf}
+}
+
+// U reads an n bit unsigned field, n <= 32
+func (r *bitReader) U(n int) uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if n > r.Remaining() {
+		r.err = fmt.Errorf("%w: %d bits needed at bit %d, %d left", ErrTruncated, n, r.pos, r.Remaining())
+		return 0
+	}
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = v<<1 | uint32(r.buf[r.pos>>3]>>(7-uint(r.pos&7))&1)
+		r.pos++
+	}
+	return v
+}
+
+// Flag reads a 1 bit field
+func (r *bitReader) Flag() bool {
+	return r.U(1) == 1
+}
+
+// UE reads an unsigned Exp-Golomb code, ue(v)
+func (r *bitReader) UE() uint32 {
+	zeros := 0
+	for r.err == nil && r.U(1) == 0 {
+		zeros++
+		if zeros > 31 {
+			r.err = fmt.Errorf("%w: Exp-Golomb code at bit %d is longer than 32 bits", ErrBadValue, r.pos)
+			return 0
+		}
+	}
+	if r.err != nil {
+		return 0
+	}
+	return (1<<uint(zeros) - 1) + r.U(zeros)
+}
+
+// SE reads a signed Exp-Golomb code, se(v)
+func (r *bitReader) SE() int32 {
+	k := r.UE()
+	if k&1 == 1 {
+		return int32((k + 1) / 2)
+	}
+	return -int32(k / 2)
+}
+
+// Skip steps over n bits
+func (r *bitReader) Skip(n int) {
+	for n > 32 && r.err == nil {
+		r.U(32)
+		n -= 32
+	}
+	r.U(n)
+}
+
+// Remaining returns the number of unread bits
+func (r *bitReader) Remaining() int {
+	return len(r.buf)*8 - r.pos
+}
+
+// Err returns the first error met
+func (r *bitReader) Err() error {
+	return r.err
+}
+
+// unescapeRBSP removes the emulation prevention bytes (the 0x03 of 0x000003) from a
+// NAL unit, giving its raw byte sequence payload
+func unescapeRBSP(nal []byte) []byte {
+	out := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, c := range nal {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
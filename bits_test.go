@@ -0,0 +1,128 @@
+package bmff
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// bitWriter builds parameter sets for the tests
+type bitWriter struct {
+	buf []byte
+	n   int // bits written
+}
+
+func (w *bitWriter) u(n int, v uint32) *bitWriter {
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>uint(i)&1) << uint(7-w.n%8)
+		w.n++
+	}
+	return w
+}
+
+func (w *bitWriter) flag(f bool) *bitWriter {
+	if f {
+		return w.u(1, 1)
+	}
+	return w.u(1, 0)
+}
+
+func (w *bitWriter) ue(v uint32) *bitWriter {
+	x := uint64(v) + 1
+	bits := 0
+	for t := x; t > 1; t >>= 1 {
+		bits++
+	}
+	w.u(bits, 0)
+	for i := bits; i >= 0; i-- {
+		w.u(1, uint32(x>>uint(i)&1))
+	}
+	return w
+}
+
+func (w *bitWriter) se(v int32) *bitWriter {
+	if v > 0 {
+		return w.ue(uint32(2*v - 1))
+	}
+	return w.ue(uint32(-2 * v))
+}
+
+// nal returns the written bits as a NAL unit: header, then the payload with its stop
+// bit and emulation prevention bytes
+func (w *bitWriter) nal(header ...byte) []byte {
+	w.u(1, 1)
+	for w.n%8 != 0 {
+		w.u(1, 0)
+	}
+	out := append([]byte{}, header...)
+	zeros := 0
+	for _, c := range w.buf {
+		if zeros >= 2 && c <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		out = append(out, c)
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+func TestBitReader(t *testing.T) {
+	w := &bitWriter{}
+	w.u(3, 5).ue(0).ue(1).ue(254).se(-7).se(7).flag(true).u(32, 0xdeadbeef).ue(1<<32 - 2)
+	r := newBitReader(w.buf)
+	if v := r.U(3); v != 5 {
+		t.Errorf("U(3) = %d, want 5", v)
+	}
+	for _, want := range []uint32{0, 1, 254} {
+		if v := r.UE(); v != want {
+			t.Errorf("UE() = %d, want %d", v, want)
+		}
+	}
+	for _, want := range []int32{-7, 7} {
+		if v := r.SE(); v != want {
+			t.Errorf("SE() = %d, want %d", v, want)
+		}
+	}
+	if !r.Flag() {
+		t.Errorf("Flag() = false")
+	}
+	if v := r.U(32); v != 0xdeadbeef {
+		t.Errorf("U(32) = %x", v)
+	}
+	if v := r.UE(); v != 1<<32-2 || r.Err() != nil {
+		t.Errorf("UE() = %d, error %v", v, r.Err())
+	}
+	r.U(r.Remaining())
+	if r.U(1); !errors.Is(r.Err(), ErrTruncated) {
+		t.Errorf("read past the end: error %v", r.Err())
+	}
+
+	long := newBitReader(make([]byte, 8))
+	if long.UE(); !errors.Is(long.Err(), ErrBadValue) {
+		t.Errorf("64 leading zeros: error %v", long.Err())
+	}
+}
+
+func TestUnescapeRBSP(t *testing.T) {
+	tests := []struct {
+		in, want []byte
+	}{
+		{[]byte{0, 0, 3, 1}, []byte{0, 0, 1}},
+		{[]byte{0, 0, 3, 0, 0, 3}, []byte{0, 0, 0, 0}},
+		{[]byte{0, 3, 0, 0, 3}, []byte{0, 3, 0, 0}},
+		{[]byte{1, 2, 3}, []byte{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		if got := unescapeRBSP(tt.in); !bytes.Equal(got, tt.want) {
+			t.Errorf("unescapeRBSP(%x) = %x, want %x", tt.in, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package bmff
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -44,8 +45,20 @@ type box struct {
 	usertype  string     // if boxtype == 'uuid' then this is that uuid
 	size      uint32     // size includes all header data starting at firt byte (boxtype)
 	largesize int64      // if size == 1 then use this 'largesize' for size
+	eofSize   int64      // if size == 0 the box extends to end of file. this is its actual size
+	offset    int64      // where the box starts, relative to the start of the parsed stream
+	hdrSize   int        // bytes of size, boxtype, largesize and usertype preceding raw
 	boxExt_s             // this embedded field embodies the "Full Box extension"... available for all boxes
 	raw       []byte
+	childOff  int    // bytes of raw ahead of the first child box, e.g. the entry count of stsd
+	tail      []byte // end of raw after a child header that could not be read, written back out as is
+
+	ps *parseState // options and diagnostics of the parse that found this box
+
+	// lazy payload: when src is set the payload was left in the source and raw is empty
+	src        io.ReaderAt
+	payloadOff int64 // offset of the payload within src
+	payloadLen int64 // payload length in bytes
 
 	// container Vars boxes typically don't act as containers and also decoders
 	typeNotDecoded star // flag that we don't know how to parse this
@@ -67,6 +80,7 @@ type Box interface {
 	Raw() []byte // when subBoxes exist, raw returns an empty array
 
 	GetSubBoxCount() int
+	Children() []Box
 	ResetSubBox()
 	GetSubBox() (Box, error)
 	AddSubBox(Box)
@@ -75,14 +89,36 @@ type Box interface {
 	PrintRecursive()
 	Output(io.Writer, int) (writeCount int, err error)
 	SizeHeader() int
+	Offset() int64
+	HeaderSize() int
+
+	Find(path string) []Box
+	FindFirst(path string) Box
 }
 
 // helper function to parse the FullBox Extension
 // note:  Parsing is pulled from the raw payload... size is not adjusted
-func (b *box) parseFullBoxExt() {
-	b.isFullBox = true
-	b.version = b.raw[0]
-	copy(b.flags[0:3], b.raw[1:4])
+// returns a cursor positioned after the version and flags
+func (b *box) fullBox() *cursor {
+	c := newCursor(b.raw)
+	if ext := c.Bytes(4); ext != nil {
+		b.isFullBox = true
+		b.version = ext[0]
+		copy(b.flags[0:3], ext[1:4])
+	}
+	return c
+}
+
+// FullBoxHeader reads the version and flags at the start of a full box payload.
+// It is meant for decoders registered with RegisterBox: the box's own fields follow
+// at Raw()[4:], and Output writes the header back out with the rest of the payload.
+// ErrTruncated is returned when the payload is shorter than 4 bytes.
+func (b *box) FullBoxHeader() (version uint8, flags uint32, err error) {
+	c := b.fullBox()
+	if err = c.Err(); err != nil {
+		return 0, 0, err
+	}
+	return b.version, uint32(b.flags[0])<<16 | uint32(b.flags[1])<<8 | uint32(b.flags[2]), nil
 }
 
 // recursive function to print out the box type, size and substructure of a box
@@ -92,19 +128,11 @@ func (b *box) PrintDetail() {
 	if cCount > 0 {
 		children = fmt.Sprintf("%2d ", cCount)
 	}
-	fmt.Printf("%-16s %-19s %7d\n", b.Tag.String(), b.Tag.Indent()+children+b.boxtype+" "+b.typeNotDecoded.String()+"^", b.size)
+	fmt.Printf("%-16s %-19s %7d\n", b.Tag.String(), b.Tag.Indent()+children+b.displayType()+" "+b.typeNotDecoded.String()+"^", b.size)
 }
 
 func (b *box) PrintRecursive() {
-	var bx Box
-	bx = b
-	bx.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-	}
+	printTree(b)
 }
 
 func (b *box) Size() int64 {
@@ -114,9 +142,32 @@ func (b *box) Size() int64 {
 	if b.size == 1 {
 		return b.largesize
 	}
+	if b.size == 0 {
+		return b.eofSize
+	}
 	return int64(b.size)
 }
 
+// ExtendsToEOF reports whether the header carries size=0, meaning the box runs to the end of the file
+func (b *box) ExtendsToEOF() bool {
+	return b.size == 0
+}
+
+// SetExplicitSize rewrites a size=0 header into an explicit size, using largesize when
+// the box does not fit in 32 bits, so Output no longer writes the zero-size form
+func (b *box) SetExplicitSize() {
+	if b.size != 0 {
+		return
+	}
+	if b.eofSize <= 0xffffffff {
+		b.size = uint32(b.eofSize)
+	} else {
+		b.size = 1
+		b.largesize = b.eofSize + 8 // the header grows by the largesize field
+	}
+	b.eofSize = 0
+}
+
 func (b *box) Type() string {
 	return b.boxtype
 }
@@ -125,10 +176,66 @@ func (b *box) Raw() []byte {
 	return b.raw
 }
 
+// Payload returns a reader over the payload (everything after the header).
+// For lazily parsed boxes the data is read from the source on demand.
+func (b *box) Payload() *io.SectionReader {
+	if b.src != nil {
+		return io.NewSectionReader(b.src, b.payloadOff, b.payloadLen)
+	}
+	return io.NewSectionReader(bytes.NewReader(b.raw), 0, int64(len(b.raw)))
+}
+
+// Offset returns where the box was found, in bytes from the start of the parsed stream
+// (or the buffer given to NewBox).  Boxes built in memory rather than parsed return -1.
+// Offsets are not updated when the tree is modified.
+func (b *box) Offset() int64 {
+	if b.hdrSize == 0 {
+		return -1
+	}
+	return b.offset
+}
+
+// HeaderSize returns the number of bytes of size, type, largesize and usertype that
+// were read ahead of the payload.  For boxes built in memory it is the size their
+// header will be written with.
+func (b *box) HeaderSize() int {
+	if b.hdrSize == 0 {
+		return b.SizeHeader()
+	}
+	return b.hdrSize
+}
+
+// PayloadOffset returns the offset of the payload within the source for
+// lazily parsed boxes, and -1 when the payload was read into memory
+func (b *box) PayloadOffset() int64 {
+	if b.src == nil {
+		return -1
+	}
+	return b.payloadOff
+}
+
+// PayloadSize returns the payload length in bytes
+func (b *box) PayloadSize() int64 {
+	if b.src != nil {
+		return b.payloadLen
+	}
+	return int64(len(b.raw))
+}
+
+// IsLazy reports whether the payload was left in the source rather than read into memory
+func (b *box) IsLazy() bool {
+	return b.src != nil
+}
+
 func (b *box) GetSubBoxCount() int {
 	return len(b.subBox)
 }
 
+// Children returns the sub boxes in file order.  The slice belongs to the box.. don't modify it
+func (b *box) Children() []Box {
+	return b.subBox
+}
+
 func (b *box) ResetSubBox() {
 	b.readIdx = 0
 }
@@ -160,6 +267,10 @@ func (b *box) InsertSubBox(iBox Box, index int) error {
 		nBl = append(nBl, b.subBox[index:]...)
 	}
 	b.subBox = nBl
+	b.writeIdx++
+	if index < b.readIdx {
+		b.readIdx++ // keep the cursor on the same box
+	}
 	return nil // no error
 }
 
@@ -247,6 +358,18 @@ func (b *box) Output(w io.Writer, objDepth int) (writeCount int, err error) {
 		return wCount, err
 	}
 	if objDepth > 0 && b.GetSubBoxCount() != 0 {
+		// fields the container holds ahead of its children
+		prefixIdx := 0
+		if b.isFullBox {
+			prefixIdx = 4
+		}
+		if b.childOff > prefixIdx {
+			writeCnt, err := w.Write(b.raw[prefixIdx:b.childOff])
+			wCount += writeCnt
+			if err != nil {
+				return wCount, kl.KError(klog.KlrWriteFail, "%v", err)
+			}
+		}
 		for _, subBox := range b.subBox {
 			oC, bErr := subBox.Output(w, objDepth-1)
 			if bErr != nil {
@@ -254,11 +377,24 @@ func (b *box) Output(w io.Writer, objDepth int) (writeCount int, err error) {
 			}
 			wCount += oC
 		}
+		if len(b.tail) > 0 {
+			writeCnt, err := w.Write(b.tail)
+			wCount += writeCnt
+			if err != nil {
+				return wCount, kl.KError(klog.KlrWriteFail, "%v", err)
+			}
+		}
 		return wCount, nil
 	}
 
-	if b.size == 0 { // shouln't be possible
-		return 0, kl.KError(klog.KlrBadData, "size=0 not supported")
+	if b.src != nil {
+		// lazy payload... copy it straight from the source
+		copyCnt, err := io.Copy(w, b.Payload())
+		wCount += int(copyCnt)
+		if err != nil {
+			return wCount, kl.KError(klog.KlrWriteFail, "%v", err)
+		}
+		return wCount, nil
 	}
 
 	// output the raw payload...  account for the extended header
@@ -277,15 +413,83 @@ func (b *box) Output(w io.Writer, objDepth int) (writeCount int, err error) {
 // ****************************
 
 //NewBox returns a raw parsing of a box from the input io.Reader
+//  io.EOF is returned when src ends cleanly before the next box.  Any other failure
+//  is a *ParseError with its Offset relative to the start of the box.
 const boxHeaderSize = 8
 
+// payloads larger than this are read in steps, so a corrupt size cannot make us
+// allocate far more memory than the data actually holds
+const payloadReadStep = 1 << 20
+
+// readPayload reads exactly n bytes of payload from src
+func readPayload(src io.Reader, n int64) ([]byte, error) {
+	if n <= payloadReadStep {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(src, buf)
+		return buf, err
+	}
+	buf, err := io.ReadAll(io.LimitReader(src, n))
+	if err == nil && int64(len(buf)) < n {
+		err = io.ErrUnexpectedEOF
+	}
+	return buf, err
+}
+
 func NewBox(src io.Reader, newtag *efmt.Ntag) (*box, error) {
+	return readBox(src, newtag, nil)
+}
+
+// readBox is NewBox holding the payload to the limits of the parse ps (nil for none)
+func readBox(src io.Reader, newtag *efmt.Ntag, ps *parseState) (*box, error) {
+	b, bufUsed, err := readBoxHeader(src, newtag)
+	if err != nil {
+		return nil, err
+	}
+	if b.size == 0 {
+		// box extends to the end of the stream
+		if limit := ps.payloadLimit(bufUsed); limit >= 0 {
+			src = io.LimitReader(src, limit+1)
+		}
+		b.raw, err = io.ReadAll(src)
+		if err != nil {
+			return nil, readError(b.boxtype, err)
+		}
+		b.eofSize = int64(bufUsed + len(b.raw))
+		if err := ps.admit(b, int64(len(b.raw))); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	rawSize := b.Size() - int64(bufUsed)
+	if rawSize < 0 {
+		return nil, &ParseError{BoxType: b.boxtype,
+			Reason: fmt.Errorf("%w: size %d smaller than its %d byte header", ErrBadSize, b.Size(), bufUsed)}
+	}
+	if err := ps.admit(b, rawSize); err != nil {
+		return nil, err
+	}
+	if rawSize > 0 {
+		b.raw, err = readPayload(src, rawSize)
+		if err != nil {
+			return nil, readError(b.boxtype, err)
+		}
+		//fmt.Printf("%-16s %-16s %7d\n", b.Tag.String(), b.Tag.Indent()+b.boxtype, b.size)
+	}
+	return b, nil // an empty box has no payload
+}
+
+// readBoxHeader reads size, boxtype and the optional largesize and usertype.
+// returns the new box along with the number of header bytes consumed
+func readBoxHeader(src io.Reader, newtag *efmt.Ntag) (*box, int, error) {
 
 	buf := make([]byte, boxHeaderSize)
 	// read and parse first 8 bytes
-	bytesRead, err := io.ReadFull(src, buf)
+	_, err := io.ReadFull(src, buf)
+	if err == io.EOF {
+		return nil, 0, io.EOF // clean end.. no more boxes
+	}
 	if err != nil {
-		return nil, kl.KSysErr(klog.KlrSysErr, err, "bufLen=%d bytesRead=%d", len(buf), bytesRead)
+		return nil, 0, readError("", err)
 	}
 	s := binary.BigEndian.Uint32(buf[0:4])
 	b := &box{
@@ -299,7 +503,7 @@ func NewBox(src io.Reader, newtag *efmt.Ntag) (*box, error) {
 		// read in largesize and parseSdesChunk
 		_, err := io.ReadFull(src, buf)
 		if err != nil {
-			return nil, kl.KSysErr(klog.KlrSysErr, err, "")
+			return nil, 0, readError(b.boxtype, err)
 		}
 		b.largesize = int64(binary.BigEndian.Uint64(buf))
 		bufUsed += 8
@@ -309,25 +513,51 @@ func NewBox(src io.Reader, newtag *efmt.Ntag) (*box, error) {
 		buf1 := make([]byte, 16)
 		_, err := io.ReadFull(src, buf1)
 		if err != nil {
-			return nil, kl.KError(klog.KlrReadFail, "%v", err)
+			return nil, 0, readError(b.boxtype, err)
 		}
 		b.usertype = string(buf1)
 		bufUsed += 16
 	}
+	b.hdrSize = bufUsed
+	return b, bufUsed, nil
+}
+
+// newBoxAt reads the box starting at offset within src.  avail is the number of bytes
+// available from offset onwards.  Payloads of boxes we never decode (mdat, free,
+// unknown types) are left in src and read on demand through Payload()
+func newBoxAt(src io.ReaderAt, offset, avail int64, newtag *efmt.Ntag, ps *parseState) (*box, error) {
+	b, bufUsed, err := readBoxHeader(io.NewSectionReader(src, offset, avail), newtag)
+	if err != nil {
+		return nil, rebase(err, offset)
+	}
+	b.offset = offset
 	if b.size == 0 {
-		return nil, kl.KError(klog.KlrBadData, "size=0 not supported")
+		b.eofSize = avail
+	}
+	if b.Size() < int64(bufUsed) {
+		return nil, &ParseError{Offset: offset, Path: b.boxtype, BoxType: b.boxtype,
+			Reason: fmt.Errorf("%w: size %d smaller than its %d byte header", ErrBadSize, b.Size(), bufUsed)}
+	}
+	if b.Size() > avail {
+		return nil, &ParseError{Offset: offset, Path: b.boxtype, BoxType: b.boxtype,
+			Reason: fmt.Errorf("%w: box size %d with %d bytes available", ErrTruncated, b.Size(), avail)}
 	}
 	rawSize := b.Size() - int64(bufUsed)
-	if rawSize > 0 {
-		b.raw = make([]byte, rawSize)
-		_, err = io.ReadFull(src, b.raw)
-		if err != nil {
-			return nil, kl.KError(klog.KlrReadFail, "%v", err)
-		}
-		//fmt.Printf("%-16s %-16s %7d\n", b.Tag.String(), b.Tag.Indent()+b.boxtype, b.size)
+	if isLazyBox(b) {
+		b.src = src
+		b.payloadOff = offset + int64(bufUsed)
+		b.payloadLen = rawSize
 		return b, nil
 	}
-	return nil, nil
+	if err := ps.admit(b, rawSize); err != nil {
+		return nil, rebase(err, offset)
+	}
+	b.raw = make([]byte, rawSize)
+	// ReadAt may report io.EOF along with a full read at the end of src
+	if n, err := src.ReadAt(b.raw, offset+int64(bufUsed)); n != len(b.raw) {
+		return nil, rebase(readError(b.boxtype, err), offset)
+	}
+	return b, nil
 }
 
 // *********************************************************
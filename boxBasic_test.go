@@ -3,6 +3,7 @@ package bmff
 import (
 	"bytes"
 	"efmt"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -106,6 +107,90 @@ func TestBasicBoxes(t *testing.T) {
 	}
 
 }
+
+// size=0 means the box runs to the end of the file
+func TestZeroSizeBox(t *testing.T) {
+	ftyp := []byte{0, 0, 0, 16, 'f', 't', 'y', 'p', 'i', 's', 'o', 'm', 0, 0, 0, 1}
+	mdat := []byte{0, 0, 0, 0, 'm', 'd', 'a', 't', 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	data := append(append([]byte{}, ftyp...), mdat...)
+
+	b, err := NewBox(bytes.NewReader(mdat), efmt.NewNtag())
+	if err != nil {
+		t.Fatalf("NewBox() error = %v", err)
+	}
+	if !b.ExtendsToEOF() || b.Size() != int64(len(mdat)) || len(b.raw) != len(mdat)-8 {
+		t.Fatalf("NewBox() size=%d Size()=%d rawLen=%d", b.size, b.Size(), len(b.raw))
+	}
+
+	parsers := []struct {
+		name  string
+		parse func() (*File_s, error)
+	}{
+		{"Parse", func() (*File_s, error) { return Parse(bytes.NewReader(data)) }},
+		{"ParseReaderAt", func() (*File_s, error) { return ParseReaderAt(bytes.NewReader(data), int64(len(data))) }},
+	}
+	for _, p := range parsers {
+		t.Run(p.name, func(t *testing.T) {
+			f, err := p.parse()
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if f.Mdat == nil || f.Mdat.Size() != int64(len(mdat)) {
+				t.Fatalf("mdat not parsed to end of file: %+v", f.Mdat)
+			}
+
+			// the zero-size form is preserved by default
+			var out bytes.Buffer
+			if _, err := f.Output(&out, 1); err != nil {
+				t.Fatalf("Output() error = %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), data) {
+				t.Errorf("Output() = %v, want %v", out.Bytes(), data)
+			}
+
+			// and rewritten to an explicit size on request
+			f.SetExplicitSizes()
+			if f.Mdat.ExtendsToEOF() || f.Mdat.Size() != int64(len(mdat)) {
+				t.Errorf("SetExplicitSizes() left size=%d Size()=%d", f.Mdat.size, f.Mdat.Size())
+			}
+			out.Reset()
+			if _, err := f.Output(&out, 1); err != nil {
+				t.Fatalf("Output() error = %v", err)
+			}
+			want := append([]byte{}, data...)
+			want[len(ftyp)+3] = byte(len(mdat))
+			if !bytes.Equal(out.Bytes(), want) {
+				t.Errorf("Output() = %v, want %v", out.Bytes(), want)
+			}
+		})
+	}
+}
+
+// a lenient parse keeps the bytes behind a broken child header and writes them back out
+func TestContainerTailOutput(t *testing.T) {
+	broken := []byte{0, 0, 0, 100, 'f', 'r', 'e', 'e', 1, 2}
+	data := mkBox("moov", mkBox("free", []byte{1, 2}), broken)
+
+	f, diags, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseWithOptions() error = %v", err)
+	}
+	if len(diags) != 1 || !errors.Is(diags[0].Err, ErrTruncated) {
+		t.Fatalf("diagnostics = %v, want one ErrTruncated", diags)
+	}
+	if n := f.Moov.GetSubBoxCount(); n != 1 {
+		t.Fatalf("moov has %d children, want 1", n)
+	}
+
+	var out bytes.Buffer
+	if _, err := f.Output(&out, 100); err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("Output() = %v, want %v", out.Bytes(), data)
+	}
+}
+
 func compareFiles(r, w *os.File) (firstDiff int, err error) {
 	r.Seek(0, 0)
 	w.Seek(0, 0)
@@ -202,6 +287,13 @@ func TestSmallFile(t *testing.T) {
 						return
 					}
 					fileSize, err = bF0.Output(wF, depth) // just the toplevel files
+					if err != nil {
+						t.Errorf("Output(depth=%d) error = %v", depth, err)
+						return
+					}
+					if fi, sErr := rF.Stat(); sErr == nil && int64(fileSize) != fi.Size() {
+						t.Errorf("Output(depth=%d) wrote %d bytes, source has %d", depth, fileSize, fi.Size())
+					}
 
 					_, cErr := compareFiles(rF, wF)
 					if cErr != nil {
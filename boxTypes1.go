@@ -1,31 +1,89 @@
 package bmff
 
 import (
-	"encoding/binary"
 	"fmt"
 	"io"
 	"klog"
 )
 
+func init() {
+	RegisterBox("ftyp", []string{TopLevel}, parsedBy(func(b *box) parser { return &FtypBox{box: b} }))
+	RegisterBox("styp", []string{TopLevel}, parsedBy(func(b *box) parser { return &StypBox{box: b} }))
+	RegisterBox("sidx", []string{TopLevel}, parsedBy(func(b *box) parser { return &SidxBox{box: b} }))
+	// padding may appear at any level
+	RegisterBox("free", nil, parsedBy(func(b *box) parser { return &FreeBox{box: b} }))
+	RegisterBox("skip", nil, parsedBy(func(b *box) parser { return &FreeBox{box: b} }))
+}
+
 // File is the top level containter for the decode
 type File_s struct {
 	*box
 	Ftyp *FtypBox // file tyoe box
 	// pdin  progressive download info
 	Moov *MoovBox // container all metadata
-	Moof *MoofBox // movie fragment
+	Moof *MoofBox // movie fragment  (last one in the file.. see Fragments)
 	// mfra  movie fragment random access
-	Mdat *MdatBox
+	Mdat *MdatBox // (last one in the file.. see Fragments)
 	// free  free space
 	// skip  free space
 	Meta *MetaBox // metadata
-	Styp *StypBox // segment type
-	Emsg *EmsgBox // event message box
-	Sidx *SidxBox // segment index
+	Styp *StypBox // segment type  (last one in the file.. see Fragments)
+	Emsg *EmsgBox // event message box  (last one in the file.. see Fragments)
+	Sidx *SidxBox // segment index  (last one in the file.. see Fragments)
 	// meco  additional metadata container
 	// ssix  subsegement index
-	// prft  produceer reference time
+	Prft *PrftBox // producer reference time  (last one in the file.. see Fragments)
 	// AllBoxes []Box
+
+	Fragments []*Fragment // every moof in file order, grouped with its surrounding boxes..
+	// segment level boxes after the last moof are in a final Fragment with a nil Moof
+	pending *Fragment // segment level boxes seen since the last moof
+}
+
+// Fragment pairs a movie fragment with the mdat that follows it and the
+// segment level boxes (styp, sidx, emsg, prft) that precede it
+type Fragment struct {
+	Styp *StypBox
+	Sidx []*SidxBox
+	Emsg []*EmsgBox
+	Prft *PrftBox
+	Moof *MoofBox
+	Mdat *MdatBox
+}
+
+// addFragmentBox files a top level box into Fragments
+func (f *File_s) addFragmentBox(bx Box) {
+	if f.pending == nil {
+		f.pending = &Fragment{}
+	}
+	switch tb := bx.(type) {
+	case *StypBox:
+		f.pending.Styp = tb
+	case *SidxBox:
+		f.pending.Sidx = append(f.pending.Sidx, tb)
+	case *EmsgBox:
+		f.pending.Emsg = append(f.pending.Emsg, tb)
+	case *PrftBox:
+		f.pending.Prft = tb
+	case *MoofBox:
+		f.pending.Moof = tb
+		f.Fragments = append(f.Fragments, f.pending)
+		f.pending = nil
+	case *MdatBox:
+		// the first mdat following a moof carries its samples
+		if n := len(f.Fragments); n > 0 && f.Fragments[n-1].Mdat == nil {
+			f.Fragments[n-1].Mdat = tb
+		}
+	}
+}
+
+// flushFragment keeps the segment level boxes that no moof followed as a Fragment of
+// their own, once the parse is over
+func (f *File_s) flushFragment() {
+	if p := f.pending; p != nil && (p.Styp != nil || p.Sidx != nil || p.Emsg != nil || p.Prft != nil) {
+		f.Fragments = append(f.Fragments, f.pending)
+		f.pending = nil
+	}
 }
 
 // PrintAll  Helper function to output a tree of the whole file
@@ -33,13 +91,7 @@ func (f *File_s) PrintDetail() {
 	fmt.Printf("File Contents in order:\n\n")
 }
 func (b *File_s) PrintRecursive() {
-	b.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-	}
+	printTree(b)
 }
 func (f *File_s) PrintAll() {
 	f.PrintRecursive()
@@ -62,6 +114,16 @@ func (f *File_s) Output(w io.Writer, objDepth int) (byteCount int, err error) {
 	return totalByteCount, nil
 }
 
+// SetExplicitSizes rewrites any size=0 (extends to end of file) top level box header
+// into an explicit size so the next Output writes a fully sized box
+func (f *File_s) SetExplicitSizes() {
+	for _, bx := range f.subBox {
+		if sb, ok := bx.(interface{ SetExplicitSize() }); ok {
+			sb.SetExplicitSize()
+		}
+	}
+}
+
 func (f *File_s) InsertEmsg(e *EmsgBox) (rErr error) {
 	// find moof box else return error
 	for idx, sbox := range f.subBox {
@@ -72,6 +134,12 @@ func (f *File_s) InsertEmsg(e *EmsgBox) (rErr error) {
 				return kl.KError(klog.KlrWrapper, "%v", err)
 			}
 			f.Emsg = e
+			for _, frag := range f.Fragments {
+				if Box(frag.Moof) == sbox {
+					frag.Emsg = append(frag.Emsg, e)
+					break
+				}
+			}
 			return nil
 		}
 	}
@@ -82,9 +150,6 @@ func (f *File_s) InsertEmsg(e *EmsgBox) (rErr error) {
 	// if err != nil {
 	// 	return kl.KError(klog.KlrWrapper, "%v", err)
 	// }
-	f.Emsg = e
-	return nil
-
 }
 
 // *********************************************
@@ -97,13 +162,12 @@ type FtypBox struct {
 }
 
 func (b *FtypBox) parse() error {
-	b.MajorBrand, b.MinorVersion = string(b.raw[0:4]), int(binary.BigEndian.Uint32(b.raw[4:8]))
-	if l := len(b.raw); l > 8 {
-		for i := 8; i < l; i += 4 {
-			b.CompatibleBrands = append(b.CompatibleBrands, string(b.raw[i:i+4]))
-		}
+	c := newCursor(b.raw)
+	b.MajorBrand, b.MinorVersion = c.FourCC(), int(c.U32())
+	for c.Remaining() >= 4 {
+		b.CompatibleBrands = append(b.CompatibleBrands, c.FourCC())
 	}
-	return nil
+	return c.Err()
 }
 
 // specific funciton for this typwe
@@ -122,13 +186,7 @@ func (b *FtypBox) PrintDetail() {
 
 }
 func (b *FtypBox) PrintRecursive() {
-	b.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-	}
+	printTree(b)
 }
 
 // ******************************************************************
@@ -141,13 +199,12 @@ type StypBox struct {
 }
 
 func (b *StypBox) parse() error {
-	b.MajorBrand, b.MinorVersion = string(b.raw[0:4]), int(binary.BigEndian.Uint32(b.raw[4:8]))
-	if l := len(b.raw); l > 8 {
-		for i := 8; i < l; i += 4 {
-			b.CompatibleBrands = append(b.CompatibleBrands, string(b.raw[i:i+4]))
-		}
+	c := newCursor(b.raw)
+	b.MajorBrand, b.MinorVersion = c.FourCC(), int(c.U32())
+	for c.Remaining() >= 4 {
+		b.CompatibleBrands = append(b.CompatibleBrands, c.FourCC())
 	}
-	return nil
+	return c.Err()
 }
 
 // specific funciton for this typwe
@@ -166,13 +223,18 @@ func (b *StypBox) PrintDetail() {
 
 }
 func (b *StypBox) PrintRecursive() {
-	b.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-	}
+	printTree(b)
+}
+
+// *********************************************************
+
+// FreeBox is free space ('free' or 'skip').. its contents are irrelevant
+type FreeBox struct {
+	*box
+}
+
+func (b *FreeBox) parse() error {
+	return nil
 }
 
 // *********************************************************
@@ -198,34 +260,20 @@ type SidxBox struct {
 }
 
 func (b *SidxBox) parse() error {
-
-	b.parseFullBoxExt() // consume [0:4] => version and flags
-	offset := 4         // from decoding the FullBoxExt
-	b.reference_ID = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-	offset += 4
-	b.timescale = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-	offset += 4
-	if b.version == 0 {
-		b.earliest_presentation_time = uint64(binary.BigEndian.Uint32(b.raw[offset : offset+4]))
-		b.first_offset = uint64(binary.BigEndian.Uint32(b.raw[offset+4 : offset+8]))
-		offset += 8
-	} else if b.version == 1 {
-		b.earliest_presentation_time = binary.BigEndian.Uint64(b.raw[offset : offset+8])
-		b.first_offset = binary.BigEndian.Uint64(b.raw[offset+8 : offset+16])
-		offset += 16
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.reference_ID = c.U32()
+	b.timescale = c.U32()
+	b.earliest_presentation_time = c.UVersioned(b.version)
+	b.first_offset = c.UVersioned(b.version)
+	b.reserved = c.U16()
+	b.reference_count = c.U16()
+	if c.Err() == nil && int(b.reference_count)*12 > c.Remaining() {
+		return fmt.Errorf("%w: %d references need %d bytes, %d left", ErrTruncated, b.reference_count, int(b.reference_count)*12, c.Remaining())
 	}
-	b.reserved = binary.BigEndian.Uint16(b.raw[offset : offset+2])
-	offset += 2
-	b.reference_count = binary.BigEndian.Uint16(b.raw[offset : offset+2])
-	offset += 2
-	//fmt.Printf("SIDX:  offset:%d raw[0:%d] refCnt:%d \n BOX: %+v, lBox:%+v\n", offset, len(b.raw), b.reference_count, b, b.box)
 	for i := 0; i < int(b.reference_count); i++ {
-		sr := SidxRef{rawDat: b.raw[offset : offset+12]}
-		//copy(b.refs[i].rawDat[:], b.raw[offset:offset+12])
-		offset += 12
-		b.refs = append(b.refs, &sr)
+		b.refs = append(b.refs, &SidxRef{rawDat: c.Bytes(12)})
 	}
-	return nil
+	return c.Err()
 }
 
 // specific funciton for this typwe
@@ -245,11 +293,5 @@ func (b *SidxBox) PrintDetail() {
 
 }
 func (b *SidxBox) PrintRecursive() {
-	b.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-	}
+	printTree(b)
 }
@@ -1,9 +1,26 @@
 package bmff
 
-import (
-	"encoding/binary"
-	"klog"
-)
+func init() {
+	RegisterBox("moov", []string{TopLevel}, parsedBy(func(b *box) parser { return &MoovBox{box: b} }))
+	RegisterBox("mdat", []string{TopLevel}, parsedBy(func(b *box) parser { return &MdatBox{box: b} }))
+	RegisterBox("mvhd", []string{"moov"}, parsedBy(func(b *box) parser { return &MvhdBox{box: b} }))
+	RegisterBox("iods", []string{"moov"}, parsedBy(func(b *box) parser { return &IodsBox{box: b} }))
+	RegisterBox("trak", []string{"moov"}, parsedBy(func(b *box) parser { return &TrakBox{box: b} }))
+	RegisterBox("udta", []string{"moov", "trak"}, parsedBy(func(b *box) parser { return &UdtaBox{box: b} }))
+	RegisterBox("cprt", []string{"udta"}, parsedBy(func(b *box) parser { return &CprtBox{box: b} }))
+	RegisterBox("tkhd", []string{"trak"}, parsedBy(func(b *box) parser { return &TkhdBox{box: b} }))
+	RegisterBox("tref", []string{"trak"}, parsedBy(func(b *box) parser { return &TrefBox{box: b} }))
+	RegisterBox("mdia", []string{"trak"}, parsedBy(func(b *box) parser { return &MdiaBox{box: b} }))
+	RegisterBox("mdhd", []string{"mdia"}, parsedBy(func(b *box) parser { return &MdhdBox{box: b} }))
+	RegisterBox("hdlr", []string{"mdia"}, parsedBy(func(b *box) parser { return &HdlrBox{box: b} }))
+	RegisterBox("minf", []string{"mdia"}, parsedBy(func(b *box) parser { return &MinfBox{box: b} }))
+	RegisterBox("vmhd", []string{"minf"}, parsedBy(func(b *box) parser { return &VmhdBox{box: b} }))
+	RegisterBox("smhd", []string{"minf"}, parsedBy(func(b *box) parser { return &SmhdBox{box: b} }))
+	RegisterBox("hmhd", []string{"minf"}, parsedBy(func(b *box) parser { return &HmhdBox{box: b} }))
+	RegisterBox("nmhd", []string{"minf"}, parsedBy(func(b *box) parser { return &NmhdBox{box: b} }))
+	RegisterBox("dinf", []string{"minf"}, parsedBy(func(b *box) parser { return &DinfBox{box: b} }))
+	RegisterBox("stbl", []string{"minf"}, parsedBy(func(b *box) parser { return &StblBox{box: b} }))
+}
 
 // *********************************************************
 
@@ -12,41 +29,24 @@ type MoovBox struct {
 	MovieHeader *MvhdBox
 	TrackBoxes  []*TrakBox
 	Iods        *IodsBox
+	Udta        *UdtaBox
 	// Meta *MetaBox
 
 }
 
 func (b *MoovBox) parse() error {
-	var err error
-	for subBox := range readBoxes(b.raw, b.Tag) {
-		if subBox == nil {
-			return nil
-		}
-		switch subBox.boxtype {
-		case "mvhd":
-			b.MovieHeader = &MvhdBox{box: subBox}
-			if err1 := b.MovieHeader.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-		case "iods":
-			b.Iods = &IodsBox{box: subBox}
-			if err1 := b.Iods.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-		case "trak":
-			trak := &TrakBox{box: subBox}
-			if err1 := trak.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.TrackBoxes = append(b.TrackBoxes, trak)
-		default:
-			err = kl.KWarn(klog.KlrNotHandled, "%s: Unknown Moov(%s) SubType: %s\n", subBox.Tag.String(), b.Tag.String(), subBox.Type())
-			subBox.typeNotDecoded = true
+	return b.parseChildren(b.raw, nil, func(child Box) {
+		switch cb := child.(type) {
+		case *MvhdBox:
+			b.MovieHeader = cb
+		case *IodsBox:
+			b.Iods = cb
+		case *TrakBox:
+			b.TrackBoxes = append(b.TrackBoxes, cb)
+		case *UdtaBox:
+			b.Udta = cb
 		}
-		b.AddSubBox(subBox)
-	}
-
-	return err
+	})
 }
 
 // *********  Meta Data container ************************************************
@@ -65,42 +65,25 @@ type TrakBox struct {
 	Tkhd *TkhdBox
 	Tref *TrefBox
 	Mdia *MdiaBox
+	Udta *UdtaBox
+	Edts *EdtsBox
 }
 
 func (b *TrakBox) parse() error {
-	var err error
-	for subBox := range readBoxes(b.raw, b.Tag) {
-		if subBox == nil {
-			break
+	return b.parseChildren(b.raw, nil, func(child Box) {
+		switch cb := child.(type) {
+		case *TkhdBox:
+			b.Tkhd = cb
+		case *MdiaBox:
+			b.Mdia = cb
+		case *TrefBox:
+			b.Tref = cb
+		case *UdtaBox:
+			b.Udta = cb
+		case *EdtsBox:
+			b.Edts = cb
 		}
-
-		switch subBox.boxtype {
-		case "tkhd":
-			header := &TkhdBox{box: subBox}
-			if err1 := header.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Tkhd = header
-		case "mdia":
-			mdia := &MdiaBox{box: subBox}
-			if err1 := mdia.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Mdia = mdia
-		case "tref":
-			tref := &TrefBox{box: subBox}
-			if err1 := tref.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Tref = tref
-		default:
-			err = kl.KWarn(klog.KlrWrapper, "%s: Unknown Trak(%s) SubType: %s\n", subBox.Tag.String(), b.Tag.String(), subBox.Type())
-			subBox.typeNotDecoded = true
-
-		}
-		b.AddSubBox(subBox)
-	}
-	return err
+	})
 }
 
 // *********************************************************
@@ -113,47 +96,24 @@ type MdiaBox struct {
 }
 
 func (b *MdiaBox) parse() error {
-	var err error
-	for subBox := range readBoxes(b.raw, b.Tag) {
-		if subBox == nil {
-			break
+	return b.parseChildren(b.raw, nil, func(child Box) {
+		switch cb := child.(type) {
+		case *MdhdBox:
+			b.Mdhd = cb
+		case *HdlrBox:
+			b.Hdlr = cb
+		case *MinfBox:
+			b.Minf = cb
 		}
-
-		switch subBox.boxtype {
-		case "mdhd":
-			mdhd := MdhdBox{box: subBox}
-			if err1 := mdhd.parse(); err != nil {
-				return kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Mdhd = &mdhd
-		case "hdlr":
-			hdlr := HdlrBox{box: subBox}
-			if err1 := hdlr.parse(); err != nil {
-				return kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Hdlr = &hdlr
-		case "minf":
-			minf := MinfBox{box: subBox}
-			if err1 := minf.parse(); err != nil {
-				return kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Minf = &minf
-		default:
-			subBox.typeNotDecoded = true
-			err = kl.KWarn(klog.KlrNotHandled, "Unknown MdiaBox SubType: %s\n", subBox.Type())
-
-		}
-		b.AddSubBox(subBox)
-	}
-	return err
+	})
 }
 
 // *********************************************************
 
 func langString(langCode uint16) string {
 	b0 := (langCode >> 10) + 0x60
-	b1 := ((langCode >> 5) & 0x3f) + 0x60
-	b2 := ((langCode) & 0x3f) + 0x60
+	b1 := ((langCode >> 5) & 0x1f) + 0x60
+	b2 := ((langCode) & 0x1f) + 0x60
 	return string([]byte{byte(b0), byte(b1), byte(b2)})
 	//fmt.Printf("langCode = 0x%x langStr = %s\n",b.langCode, b.langStr)
 }
@@ -170,30 +130,23 @@ type MdhdBox struct {
 
 // <Media Header Box
 func (b *MdhdBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
+	c := b.fullBox() // consume [0:4] => version and flags
 
 	// Fullbox payload begins at offset 4
+	b.CreationTime = c.UVersioned(b.version)
+	b.ModificationTime = c.UVersioned(b.version)
+	b.TimeScale = c.U32()
+	b.Duration = c.UVersioned(b.version)
 
-	var offset int
-	if b.version == 0 {
-		b.CreationTime = uint64(binary.BigEndian.Uint32(b.raw[4:8]))
-		b.ModificationTime = uint64(binary.BigEndian.Uint32(b.raw[8:12]))
-		b.TimeScale = binary.BigEndian.Uint32(b.raw[12:16])
-		b.Duration = uint64(binary.BigEndian.Uint32(b.raw[16:20]))
-		offset = 20
-	} else if b.version == 1 {
-		b.CreationTime = binary.BigEndian.Uint64(b.raw[4:12])
-		b.ModificationTime = binary.BigEndian.Uint64(b.raw[12:20])
-		b.TimeScale = binary.BigEndian.Uint32(b.raw[20:24])
-		b.Duration = binary.BigEndian.Uint64(b.raw[24:32])
-		offset = 32
-	}
-
-	//b.langCode = binary.BigEndian.Uint16(b.raw[offset : offset+2])
-	b.langCode = (uint16(b.raw[offset])<<8 | uint16(b.raw[offset+1]))
+	b.langCode = c.U16()
 	b.langStr = langString(b.langCode)
 
-	return nil
+	return c.Err()
+}
+
+// Language returns the ISO 639-2/T code of the media's language, e.g. "eng"
+func (b *MdhdBox) Language() string {
+	return b.langStr
 }
 
 // *********************************************************
@@ -207,12 +160,17 @@ type HdlrBox struct {
 }
 
 func (b *HdlrBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
+	c := b.fullBox() // consume [0:4] => version and flags
 
 	// Fullbox payload begins at offset 4
-	// skip over Predefined (4 bytes)
-	b.handlerType = binary.BigEndian.Uint32(b.raw[8:12])
-	return nil
+	c.Skip(4) // Predefined
+	b.handlerType = c.U32()
+	return c.Err()
+}
+
+// HandlerType returns the four character handler type, e.g. "vide" or "soun"
+func (b *HdlrBox) HandlerType() string {
+	return fourCCString(b.handlerType)
 }
 
 // *********************************************************
@@ -230,57 +188,22 @@ type MinfBox struct {
 }
 
 func (b *MinfBox) parse() error {
-	var err error
-	for subBox := range readBoxes(b.raw, b.Tag) {
-		if subBox == nil {
-			break
-		}
-
-		switch subBox.boxtype {
-		case "vmhd":
-			vmhd := VmhdBox{box: subBox}
-			if err1 := vmhd.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Vmhd = &vmhd
-		case "smhd":
-			smhd := SmhdBox{box: subBox}
-			if err1 := smhd.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Smhd = &smhd
-		case "hmhd":
-			hmhd := HmhdBox{box: subBox}
-			if err1 := hmhd.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Hmhd = &hmhd
-		case "nmhd":
-			nmhd := NmhdBox{box: subBox}
-			if err1 := nmhd.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Nmhd = &nmhd
-		case "dinf":
-			dinf := DinfBox{box: subBox}
-			if err1 := dinf.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Dinf = &dinf
-		case "stbl":
-			stbl := StblBox{box: subBox}
-			if err1 := stbl.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Stbl = &stbl
-		default:
-			err = kl.KWarn(klog.KlrNotHandled, "Unknown Minf SubType: %s\n", subBox.Type())
-			subBox.typeNotDecoded = true
-
+	return b.parseChildren(b.raw, nil, func(child Box) {
+		switch cb := child.(type) {
+		case *VmhdBox:
+			b.Vmhd = cb
+		case *SmhdBox:
+			b.Smhd = cb
+		case *HmhdBox:
+			b.Hmhd = cb
+		case *NmhdBox:
+			b.Nmhd = cb
+		case *DinfBox:
+			b.Dinf = cb
+		case *StblBox:
+			b.Stbl = cb
 		}
-		b.AddSubBox(subBox)
-	}
-	return err
+	})
 }
 
 //
@@ -294,9 +217,9 @@ type VmhdBox struct {
 }
 
 func (b *VmhdBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
+	c := b.fullBox() // consume [0:4] => version and flags
 	//no decoding required
-	return nil
+	return c.Err()
 }
 
 // *********************************************************
@@ -309,10 +232,10 @@ type SmhdBox struct {
 }
 
 func (b *SmhdBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
+	c := b.fullBox() // consume [0:4] => version and flags
 
 	//no decoding required
-	return nil
+	return c.Err()
 }
 
 // *********************************************************
@@ -328,14 +251,14 @@ type HmhdBox struct {
 }
 
 func (b *HmhdBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
-	b.maxPDUsize = binary.BigEndian.Uint16(b.raw[4:6])
-	b.avgPDUsize = binary.BigEndian.Uint16(b.raw[6:8])
-	b.maxbitrate = binary.BigEndian.Uint32(b.raw[8:12])
-	b.avgbitrate = binary.BigEndian.Uint32(b.raw[12:16])
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.maxPDUsize = c.U16()
+	b.avgPDUsize = c.U16()
+	b.maxbitrate = c.U32()
+	b.avgbitrate = c.U32()
 	// reserved not decoded
 
-	return nil
+	return c.Err()
 }
 
 // Null Media Header
@@ -344,36 +267,68 @@ type NmhdBox struct {
 }
 
 func (b *NmhdBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
+	c := b.fullBox() // consume [0:4] => version and flags
 
 	//no decoding required
-	return nil
+	return c.Err()
 }
 
 // Data Information box, container
 type DinfBox struct {
 	*box
-	balance  Int8_8
-	reserved uint16
+	Dref *DrefBox
 }
 
 func (b *DinfBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
-
-	//no decoding required
-	return nil
+	return b.parseChildren(b.raw, nil, func(child Box) {
+		switch cb := child.(type) {
+		case *DrefBox:
+			b.Dref = cb
+		}
+	})
 }
 
-// Data Information box, container
+// Sample Table box, container
 type StblBox struct {
 	*box
+	Stsd *StsdBox
+	Stts *SttsBox
+	Ctts *CttsBox
+	Stsc *StscBox
+	Stsz *StszBox
+	Stz2 *Stz2Box
+	Stco *StcoBox
+	Co64 *Co64Box
+	Stss *StssBox
+	Sdtp *SdtpBox
 }
 
 func (b *StblBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
-
-	//no decoding required
-	return nil
+	// the tables not decoded yet stay as raw sub boxes
+	return b.parseChildren(b.raw, keepRaw, func(child Box) {
+		switch cb := child.(type) {
+		case *StsdBox:
+			b.Stsd = cb
+		case *SttsBox:
+			b.Stts = cb
+		case *CttsBox:
+			b.Ctts = cb
+		case *StscBox:
+			b.Stsc = cb
+		case *StszBox:
+			b.Stsz = cb
+		case *Stz2Box:
+			b.Stz2 = cb
+		case *StcoBox:
+			b.Stco = cb
+		case *Co64Box:
+			b.Co64 = cb
+		case *StssBox:
+			b.Stss = cb
+		case *SdtpBox:
+			b.Sdtp = cb
+		}
+	})
 }
 
 // *********************************************************
@@ -386,27 +341,11 @@ type UdtaBox struct {
 }
 
 func (b *UdtaBox) parse() error {
-	var err error
-	for subBox := range readBoxes(b.raw, b.Tag) {
-		if subBox == nil {
-			break
-		}
-
-		switch subBox.boxtype {
-		case "cprt":
-			cprt := CprtBox{box: subBox}
-			if err1 := cprt.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Cprt = &cprt
-		default:
-			err = kl.KWarn(klog.KlrNotHandled, "Unknown Udta SubType: %s\n", subBox.Type())
-			subBox.typeNotDecoded = true
-
+	return b.parseChildren(b.raw, nil, func(child Box) {
+		if cprt, ok := child.(*CprtBox); ok {
+			b.Cprt = cprt
 		}
-		b.AddSubBox(subBox)
-	}
-	return err
+	})
 }
 
 // HintMediaHeader
@@ -418,19 +357,16 @@ type CprtBox struct {
 }
 
 func (b *CprtBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
+	c := b.fullBox() // consume [0:4] => version and flags
 
-	offset := 4
-	//b.langCode = binary.BigEndian.Uint16(b.raw[offset : offset+2])
-	b.langCode = (uint16(b.raw[offset])<<8 | uint16(b.raw[offset+1]))
+	b.langCode = c.U16()
 	b.langStr = langString(b.langCode)
-	offset += 2
 
 	// null terminated string in UTF-8 or UTF-16
 	// if UTF-16 starts with BYTE_ORDER_MARK (0xfeff)
-	b.notice = string(b.raw[offset:])
+	b.notice = string(c.Rest())
 
-	return nil
+	return c.Err()
 }
 
 // *********************************************************
@@ -450,41 +386,21 @@ type MvhdBox struct {
 }
 
 func (b *MvhdBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
-	var offset int
-	var err error
-	if b.version == 0 {
-		b.CreationTime = uint64(binary.BigEndian.Uint32(b.raw[4:8]))
-		b.ModificationTime = uint64(binary.BigEndian.Uint32(b.raw[8:12]))
-		b.TimeScale = binary.BigEndian.Uint32(b.raw[12:16])
-		b.Duration = uint64(binary.BigEndian.Uint32(b.raw[16:20]))
-		offset = 20
-	} else if b.version == 1 {
-		b.CreationTime = binary.BigEndian.Uint64(b.raw[4:12])
-		b.ModificationTime = binary.BigEndian.Uint64(b.raw[12:20])
-		b.TimeScale = binary.BigEndian.Uint32(b.raw[20:24])
-		b.Duration = binary.BigEndian.Uint64(b.raw[24:32])
-		offset = 32
-	}
-
-	if err1 := b.Rate.UnmarshalBinary(b.raw[offset : offset+4]); err1 != nil {
-		err = kl.KWarn(klog.KlrFuncFail, "%v: failed to unmarshal rate", err1)
-	}
-
-	if err1 := b.Volume.UnmarshalBinary(b.raw[offset+4 : offset+6]); err1 != nil {
-		err = kl.KWarn(klog.KlrFuncFail, "%v: failed to unmarshal volume", err1)
-	}
-
-	b.Reserved = b.raw[offset+6 : offset+16]
-	offset += 16
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.CreationTime = c.UVersioned(b.version)
+	b.ModificationTime = c.UVersioned(b.version)
+	b.TimeScale = c.U32()
+	b.Duration = c.UVersioned(b.version)
+
+	b.Rate = Uint16_16(c.U32())
+	b.Volume = Uint8_8(c.U16())
+	b.Reserved = c.Bytes(10)
 	for i := 0; i < 9; i++ {
-		b.Matrix[i] = int32(binary.BigEndian.Uint32(b.raw[offset+i : offset+i+4]))
+		b.Matrix[i] = int32(c.U32())
 	}
-	offset += 36
-
-	b.Predefined = b.raw[offset : offset+24]
-	b.NextTrackID = binary.BigEndian.Uint32(b.raw[offset+24 : offset+28])
-	return err
+	b.Predefined = c.Bytes(24)
+	b.NextTrackID = c.U32()
+	return c.Err()
 }
 
 type IodsBox struct {
@@ -510,36 +426,24 @@ type TkhdBox struct {
 }
 
 func (b *TkhdBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
-	var offset int
-	if b.version == 0 {
-		b.CreationTime = uint64(binary.BigEndian.Uint32(b.raw[4:8]))
-		b.ModificationTime = uint64(binary.BigEndian.Uint32(b.raw[8:12]))
-		b.TrackID = binary.BigEndian.Uint32(b.raw[12:16])
-		// 16:20 reserved
-		b.Duration = uint64(binary.BigEndian.Uint32(b.raw[20:24]))
-		offset = 24
-	} else if b.version == 1 {
-		b.CreationTime = binary.BigEndian.Uint64(b.raw[4:12])
-		b.ModificationTime = binary.BigEndian.Uint64(b.raw[12:20])
-		b.TrackID = binary.BigEndian.Uint32(b.raw[20:24])
-		// 24:28 reserved
-		b.Duration = binary.BigEndian.Uint64(b.raw[28:36])
-		offset = 36
-	}
-	offset += 8 // reserved bytes
-	b.Layer = int16(binary.BigEndian.Uint16(b.raw[offset : offset+2]))
-	b.AlternateGroup = int16(binary.BigEndian.Uint16(b.raw[offset+2 : offset+4]))
-	b.Volume = int16(binary.BigEndian.Uint16(b.raw[offset+4 : offset+6]))
-	offset += 8 // previous bytes + 2 reserved
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.CreationTime = c.UVersioned(b.version)
+	b.ModificationTime = c.UVersioned(b.version)
+	b.TrackID = c.U32()
+	c.Skip(4) // reserved
+	b.Duration = c.UVersioned(b.version)
+	c.Skip(8) // reserved bytes
+	b.Layer = int16(c.U16())
+	b.AlternateGroup = int16(c.U16())
+	b.Volume = int16(c.U16())
+	c.Skip(2) // reserved
 
 	for i := 0; i < 9; i++ {
-		b.Matrix[i] = int32(binary.BigEndian.Uint32(b.raw[offset+i : offset+i+4]))
+		b.Matrix[i] = int32(c.U32())
 	}
-	offset += 36
-	b.Width = Uint16_16(binary.BigEndian.Uint32(b.raw[offset : offset+4]))
-	b.Height = Uint16_16(binary.BigEndian.Uint32(b.raw[offset+4 : offset+8]))
-	return nil
+	b.Width = Uint16_16(c.U32())
+	b.Height = Uint16_16(c.U32())
+	return c.Err()
 }
 
 // ******** Track reference containter
@@ -550,22 +454,24 @@ type TrefBox struct {
 }
 
 func (b *TrefBox) parse() error {
-	for subBox := range readBoxes(b.raw, b.Tag) {
-		if subBox == nil {
-			break
+	// every child is a reference type (hint, cdsc, chap...) holding a list of track IDs
+	refType := parsedBy(func(sb *box) parser { return &TrefTypeBox{box: sb} })
+	return b.parseChildren(b.raw, refType, func(child Box) {
+		if t, ok := child.(*TrefTypeBox); ok {
+			b.TypeBoxes = append(b.TypeBoxes, t)
 		}
-		t := TrefTypeBox{box: subBox}
-		for i := 0; i < len(t.raw); i += 4 {
-			t.TrackIDs = append(t.TrackIDs, binary.BigEndian.Uint32(t.raw[i:i+4]))
-
-		}
-		b.TypeBoxes = append(b.TypeBoxes, &t)
-		b.AddSubBox(subBox)
-	}
-	return nil
+	})
 }
 
 type TrefTypeBox struct {
 	*box
 	TrackIDs []uint32
 }
+
+func (t *TrefTypeBox) parse() error {
+	c := newCursor(t.raw)
+	for c.Remaining() >= 4 {
+		t.TrackIDs = append(t.TrackIDs, c.U32())
+	}
+	return c.Err()
+}
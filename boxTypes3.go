@@ -1,11 +1,21 @@
 package bmff
 
 import (
-	"encoding/binary"
 	"fmt"
-	"klog"
+	"unsafe"
 )
 
+func init() {
+	RegisterBox("moof", []string{TopLevel}, parsedBy(func(b *box) parser { return &MoofBox{box: b} }))
+	RegisterBox("prft", []string{TopLevel}, parsedBy(func(b *box) parser { return &PrftBox{box: b} }))
+	RegisterBox("meta", []string{TopLevel, "moov", "trak", "moof", "traf", "udta"}, parsedBy(func(b *box) parser { return &MetaBox{box: b} }))
+	RegisterBox("mfhd", []string{"moof"}, parsedBy(func(b *box) parser { return &MfhdBox{box: b} }))
+	RegisterBox("traf", []string{"moof"}, parsedBy(func(b *box) parser { return &TrafBox{box: b} }))
+	RegisterBox("tfhd", []string{"traf"}, parsedBy(func(b *box) parser { return &TfhdBox{box: b} }))
+	RegisterBox("trun", []string{"traf"}, parsedBy(func(b *box) parser { return &TrunBox{box: b} }))
+	RegisterBox("tfdt", []string{"traf"}, parsedBy(func(b *box) parser { return &TfdtBox{box: b} }))
+}
+
 // *******  Movie Fragment Box **************************************************
 
 type MoofBox struct {
@@ -16,39 +26,16 @@ type MoofBox struct {
 }
 
 func (b *MoofBox) parse() error {
-	var err error
-	for subBox := range readBoxes(b.raw, b.Tag) {
-		if subBox == nil {
-			return nil
+	return b.parseChildren(b.raw, nil, func(child Box) {
+		switch cb := child.(type) {
+		case *MfhdBox:
+			b.Mfhd = cb
+		case *MetaBox:
+			b.Meta = cb
+		case *TrafBox:
+			b.Traf = append(b.Traf, cb)
 		}
-		switch subBox.boxtype {
-		case "mfhd":
-			b.Mfhd = &MfhdBox{box: subBox}
-			if err1 := b.Mfhd.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.AddSubBox(b.Mfhd)
-		case "meta":
-			b.Meta = &MetaBox{box: subBox}
-			if err1 := b.Meta.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.AddSubBox(b.Meta)
-		case "traf":
-			traf := &TrafBox{box: subBox}
-			if err1 := traf.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Traf = append(b.Traf, traf)
-			b.AddSubBox(traf)
-		default:
-			kl.KWarn(klog.KlrNotHandled, "%s: Unknown Moof subtype(%s) SubType: %s\n", subBox.Tag.String(), b.Tag.String(), subBox.Type())
-			subBox.typeNotDecoded = true
-			b.AddSubBox(subBox)
-		}
-	}
-
-	return err
+	})
 }
 
 // specific funciton for this typwe
@@ -63,13 +50,7 @@ func (b *MoofBox) PrintDetail() {
 
 }
 func (b *MoofBox) PrintRecursive() {
-	b.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-	}
+	printTree(b)
 }
 
 // *********************************************************
@@ -80,9 +61,9 @@ type MfhdBox struct {
 }
 
 func (b *MfhdBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
-	b.sequence_number = binary.BigEndian.Uint32(b.raw[4:8])
-	return nil
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.sequence_number = c.U32()
+	return c.Err()
 }
 
 func (b *MfhdBox) PrintDetail() {
@@ -92,19 +73,7 @@ func (b *MfhdBox) PrintDetail() {
 
 }
 func (b *MfhdBox) PrintRecursive() {
-	b.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	if err != nil {
-		return // kl.KError(KlrWrapper, "%v", err)
-	}
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-		if err != nil {
-			return // kl.KError(KlrWrapper, "%v", err)
-		}
-	}
+	printTree(b)
 }
 
 // ****** Meta Data***************************************************
@@ -128,52 +97,33 @@ type TrafBox struct {
 	Trun *TrunBox
 	Tfdt *TfdtBox
 	Meta *MetaBox
+	Tfxd *TfxdBox     // Smooth Streaming
+	Tfrf *TfrfBox     // Smooth Streaming
+	Senc *PiffSencBox // PIFF
+	Sdtp *SdtpBox
 }
 
 func (b *TrafBox) parse() error {
-	var err error
-	for subBox := range readBoxes(b.raw, b.Tag) {
-		if subBox == nil {
-			break
+	return b.parseChildren(b.raw, nil, func(child Box) {
+		switch cb := child.(type) {
+		case *TfhdBox:
+			b.Tfhd = cb
+		case *TrunBox:
+			b.Trun = cb
+		case *TfdtBox:
+			b.Tfdt = cb
+		case *MetaBox:
+			b.Meta = cb
+		case *TfxdBox:
+			b.Tfxd = cb
+		case *TfrfBox:
+			b.Tfrf = cb
+		case *PiffSencBox:
+			b.Senc = cb
+		case *SdtpBox:
+			b.Sdtp = cb
 		}
-
-		switch subBox.boxtype {
-		case "tfhd":
-			header := &TfhdBox{box: subBox}
-			if err1 := header.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Tfhd = header
-			b.AddSubBox(header)
-		case "trun":
-			header := &TrunBox{box: subBox}
-			if err1 := header.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Trun = header
-			b.AddSubBox(header)
-		case "tfdt":
-			header := &TfdtBox{box: subBox}
-			if err1 := header.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Tfdt = header
-			b.AddSubBox(header)
-		case "meta":
-			meta := &MetaBox{box: subBox}
-			if err1 := meta.parse(); err1 != nil {
-				err = kl.KWarn(klog.KlrWrapper, "%v", err1)
-			}
-			b.Meta = meta
-			b.AddSubBox(meta)
-		default:
-			err = kl.KWarn(klog.KlrNotHandled, "Unknown Traf SubType: %s\n", subBox.Type())
-			b.AddSubBox(subBox)
-			subBox.typeNotDecoded = true
-
-		}
-	}
-	return err
+	})
 }
 func (b *TrafBox) PrintDetail() {
 	children := "   "
@@ -187,13 +137,7 @@ func (b *TrafBox) PrintDetail() {
 
 }
 func (b *TrafBox) PrintRecursive() {
-	b.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-	}
+	printTree(b)
 }
 
 // *********************************************************
@@ -234,50 +178,24 @@ type TfhdBox struct { // section 8.8.7.1
 }
 
 func (b *TfhdBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
-	offset := 4         // from decoding the FullBoxExt - version not used
-	rawLen := len(b.raw)
-	if rawLen-offset < 4 {
-		return kl.KWarn(klog.KlrRanOutOfData, "TfhdBox.parse ran out of bits")
-	}
-	b.track_ID = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-	offset += 4 // from decoding the FullBoxExt - version not used
+	c := b.fullBox() // consume [0:4] => version and flags.. version not used
+	b.track_ID = c.U32()
 	if (b.flags[2] & 0x01) != 0 {
-		if rawLen-offset < 8 {
-			return kl.KWarn(klog.KlrRanOutOfData, "TfhdBox.parse ran out of bits")
-		}
-		b.base_data_offset = binary.BigEndian.Uint64(b.raw[offset : offset+8])
-		offset += 8
+		b.base_data_offset = c.U64()
 	}
 	if (b.flags[2] & 0x02) != 0 {
-		if rawLen-offset < 4 {
-			return kl.KWarn(klog.KlrRanOutOfData, "TfhdBox.parse ran out of bits")
-		}
-		b.sample_description_index = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-		offset += 4
+		b.sample_description_index = c.U32()
 	}
 	if (b.flags[2] & 0x08) != 0 {
-		if rawLen-offset < 4 {
-			return kl.KWarn(klog.KlrRanOutOfData, "TfhdBox.parse ran out of bits")
-		}
-		b.default_sample_duration = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-		offset += 4
+		b.default_sample_duration = c.U32()
 	}
 	if (b.flags[2] & 0x10) != 0 {
-		if rawLen-offset < 4 {
-			return kl.KWarn(klog.KlrRanOutOfData, "TfhdBox.parse ran out of bits")
-		}
-		b.default_sample_size = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-		offset += 4
+		b.default_sample_size = c.U32()
 	}
 	if (b.flags[2] & 0x20) != 0 {
-		if rawLen-offset < 4 {
-			return kl.KWarn(klog.KlrRanOutOfData, "TfhdBox.parse ran out of bits")
-		}
-		b.default_sample_flags = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-		offset += 4
+		b.default_sample_flags = c.U32()
 	}
-	return nil
+	return c.Err()
 }
 func (b *TfhdBox) PrintDetail() {
 	children := "   "
@@ -290,13 +208,7 @@ func (b *TfhdBox) PrintDetail() {
 
 }
 func (b *TfhdBox) PrintRecursive() {
-	b.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-	}
+	printTree(b)
 }
 
 // *********************************************************
@@ -312,38 +224,22 @@ type TrunBox struct {
 	sample_count       uint32
 	data_offset        int32 // option (Flag bit)
 	first_sample_flags uint32
-	rSamples           []TrunSample
+	rSamples           []TrunSample // only the first sample's when the run has no per sample fields
 }
 
 func (b *TrunBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
-	offset := 4         // from decoding the FullBoxExt - version not used
-	rawLen := len(b.raw)
-
-	if rawLen-offset < 4 {
-		return kl.KWarn(klog.KlrRanOutOfData, "TrunBox.parse ran out of bits fetching sample_count")
-	}
-	b.sample_count = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-	offset += 4
+	c := b.fullBox() // consume [0:4] => version and flags.. version not used
+	b.sample_count = c.U32()
 
 	if (b.flags[2] & 0x01) != 0 { // data-offset-present flag
-		if rawLen-offset < 4 {
-			return kl.KWarn(klog.KlrRanOutOfData, "TrunBox.parse ran out of bits fetching data_offset")
-		}
-		b.data_offset = int32(binary.BigEndian.Uint32(b.raw[offset : offset+4]))
-		//kl.KTrace("TrunBox.parse: data_offset is present and is %d", b.data_offset)
-		offset += 4 // from decoding the FullBoxExt - version not used
+		b.data_offset = int32(c.U32())
 	}
 	first_sample_flags_present := (b.flags[2] & 0x04) != 0
 	if first_sample_flags_present {
 		// when present indicaates:
 		// - first_sample_flags is present in stream
 		// - sample flags NOT present in loop
-		if rawLen-offset < 4 {
-			return kl.KWarn(klog.KlrRanOutOfData, "TrunBox.parse ran out of bits fetching first_sample_flags")
-		}
-		b.first_sample_flags = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-		offset += 4 // from decoding the FullBoxExt - version not used
+		b.first_sample_flags = c.U32()
 	}
 
 	// flags for in-loop data presenr
@@ -352,52 +248,54 @@ func (b *TrunBox) parse() error {
 	sample_flags_present := ((b.flags[1] & 0x04) != 0) && (!first_sample_flags_present)
 	sample_composition_time_offset_present := (b.flags[1] & 0x08) != 0
 
-	//for idx := 0; idx < int(b.sample_count); idx++ {
+	// check the whole run is there before allocating for it
+	recSize := 0
+	for _, present := range []bool{sample_duration_present, sample_size_present, sample_flags_present, sample_composition_time_offset_present} {
+		if present {
+			recSize += 4
+		}
+	}
+	if c.Err() != nil {
+		return c.Err()
+	}
+	if uint64(b.sample_count)*uint64(recSize) > uint64(c.Remaining()) {
+		return fmt.Errorf("%w: %d samples of %d bytes, %d bytes left", ErrTruncated, b.sample_count, recSize, c.Remaining())
+	}
+	if recSize == 0 {
+		// nothing per sample.. every sample takes the defaults, apart from the flags
+		// a first_sample_flags field sets for the first one
+		if first_sample_flags_present && b.sample_count > 0 {
+			b.rSamples = []TrunSample{{sample_flags: b.first_sample_flags}}
+		}
+		return nil
+	}
+	if err := b.state().allocateSamples(uint64(b.sample_count), int(unsafe.Sizeof(TrunSample{}))); err != nil {
+		return err
+	}
+
+	b.rSamples = make([]TrunSample, 0, b.sample_count)
 	for idx := 0; idx < int(b.sample_count); idx++ {
-		sd := uint32(0)
+		if err := b.state().tick(idx); err != nil {
+			return err
+		}
+		ts := TrunSample{}
 		if sample_duration_present {
-			if rawLen-offset < 4 {
-				return kl.KWarn(klog.KlrRanOutOfData, "TrunBox.parse ran out of bits fetching sample_duration (%d of %d)", idx, b.sample_count)
-			}
-			sd = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-			offset += 4 // from decoding the FullBoxExt - version not used
+			ts.sample_duration = c.U32()
 		}
-
-		ss := uint32(0)
 		if sample_size_present {
-			if rawLen-offset < 4 {
-				return kl.KWarn(klog.KlrRanOutOfData, "TrunBox.parse ran out of bits fetching sample_size in loop (%d of %d)", idx, b.sample_count)
-			}
-			ss = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-			offset += 4 // from decoding the FullBoxExt - version not used
+			ts.sample_size = c.U32()
 		}
-		local_sfp := sample_flags_present && !first_sample_flags_present
-		sf := uint32(0)
-		if local_sfp {
-			if rawLen-offset < 4 {
-				return kl.KWarn(klog.KlrRanOutOfData, "TrunBox.parse ran out of bits fetching sample_flags in loop (%d of %d)", idx, b.sample_count)
-			}
-			sf = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-			offset += 4 // from decoding the FullBoxExt - version not used
+		if sample_flags_present {
+			ts.sample_flags = c.U32()
 		} else if (idx == 0) && first_sample_flags_present {
-			sf = b.first_sample_flags
+			ts.sample_flags = b.first_sample_flags
 		}
-
-		scto := uint32(0)
 		if sample_composition_time_offset_present {
-			if rawLen-offset < 4 {
-				return kl.KWarn(klog.KlrRanOutOfData, "TrunBox.parse ran out of bytes(need 4 have %d) fetching sample_composition_time_offset in loop (%d of %d)", rawLen-offset, idx, b.sample_count)
-			}
-			scto = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-			offset += 4 // from decoding the FullBoxExt - version not used
+			ts.sample_composition_time_offset = c.U32()
 		}
-		// if sd == ss || sf == scto {
-		// 	fmt.Printf("Hello WOrld\n")
-		// }
-		ts := TrunSample{sample_duration: sd, sample_size: ss, sample_flags: sf, sample_composition_time_offset: scto}
 		b.rSamples = append(b.rSamples, ts)
 	}
-	return nil
+	return c.Err()
 }
 
 func (b *TrunBox) PrintDetail() {
@@ -429,13 +327,7 @@ func (b *TrunBox) PrintDetail() {
 
 }
 func (b *TrunBox) PrintRecursive() {
-	b.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-	}
+	printTree(b)
 }
 
 // *********************************************************
@@ -446,16 +338,9 @@ type TfdtBox struct {
 }
 
 func (b *TfdtBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] => version and flags
-	offset := 4         // from decoding the FullBoxExt
-	if b.version == 0 {
-		b.baseMediaDecodeTime = uint64(binary.BigEndian.Uint32(b.raw[offset : offset+4]))
-		//offset += 4
-	} else if b.version == 1 {
-		b.baseMediaDecodeTime = binary.BigEndian.Uint64(b.raw[offset : offset+8])
-		//offset += 8
-	}
-	return nil
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.baseMediaDecodeTime = c.UVersioned(b.version)
+	return c.Err()
 }
 
 func (b *TfdtBox) PrintDetail() {
@@ -465,11 +350,33 @@ func (b *TfdtBox) PrintDetail() {
 
 }
 func (b *TfdtBox) PrintRecursive() {
-	b.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-	}
+	printTree(b)
+}
+
+// *********************************************************
+// ProducerReferenceTimeBox
+// relates the decode time of a sample in the following moof to an NTP wallclock time
+type PrftBox struct {
+	*box
+	ReferenceTrackID uint32
+	NtpTimestamp     uint64 // NTP format: upper 32 bits seconds since 1900, lower 32 bits fraction
+	MediaTime        uint64 // in units of the reference track's timescale
+}
+
+func (b *PrftBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.ReferenceTrackID = c.U32()
+	b.NtpTimestamp = c.U64()
+	b.MediaTime = c.UVersioned(b.version)
+	return c.Err()
+}
+
+func (b *PrftBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("refTrackID:%d ntpTimestamp:0x%016x mediaTime:%d ", b.ReferenceTrackID, b.NtpTimestamp, b.MediaTime)
+	fmt.Printf("\n")
+
+}
+func (b *PrftBox) PrintRecursive() {
+	printTree(b)
 }
@@ -0,0 +1,185 @@
+package bmff
+
+import (
+	"fmt"
+)
+
+// extended type ('uuid') boxes
+
+func init() {
+	RegisterUUID(UUIDTfxd.String(), []string{"traf"}, parsedBy(func(b *box) parser { return &TfxdBox{box: b} }))
+	RegisterUUID(UUIDTfrf.String(), []string{"traf"}, parsedBy(func(b *box) parser { return &TfrfBox{box: b} }))
+	RegisterUUID(UUIDPiffSenc.String(), []string{"traf"}, parsedBy(func(b *box) parser { return &PiffSencBox{box: b} }))
+	// XMP may be found at the top level, in moov, trak or udta
+	RegisterUUID(UUIDXMP.String(), nil, parsedBy(func(b *box) parser { return &XmpBox{box: b} }))
+}
+
+// *********************************************************
+// Smooth Streaming TfxdBox: absolute time and duration of the fragment it is in
+type TfxdBox struct {
+	*box
+	FragmentAbsoluteTime uint64 // in the track's timescale
+	FragmentDuration     uint64
+}
+
+func (b *TfxdBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.FragmentAbsoluteTime = c.UVersioned(b.version)
+	b.FragmentDuration = c.UVersioned(b.version)
+	return c.Err()
+}
+
+func (b *TfxdBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.displayType()+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("absTime:%d duration:%d", b.FragmentAbsoluteTime, b.FragmentDuration)
+	fmt.Printf("\n")
+}
+func (b *TfxdBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Smooth Streaming TfrfBox: times of the fragments following the one it is in (live look ahead)
+type TfrfEntry struct {
+	FragmentAbsoluteTime uint64
+	FragmentDuration     uint64
+}
+
+type TfrfBox struct {
+	*box
+	Entries []TfrfEntry
+}
+
+func (b *TfrfBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	count := int(c.U8())
+	for i := 0; i < count && c.Err() == nil; i++ {
+		e := TfrfEntry{FragmentAbsoluteTime: c.UVersioned(b.version)}
+		e.FragmentDuration = c.UVersioned(b.version)
+		b.Entries = append(b.Entries, e)
+	}
+	return c.Err()
+}
+
+func (b *TfrfBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.displayType()+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("fragments(%d):", len(b.Entries))
+	for _, e := range b.Entries {
+		fmt.Printf(" %d+%d", e.FragmentAbsoluteTime, e.FragmentDuration)
+	}
+	fmt.Printf("\n")
+}
+func (b *TfrfBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// PIFF SampleEncryptionBox: per sample initialization vectors and subsample ranges
+//
+// flags 0x000001 override-TrackEncryptionBox-parameters: AlgorithmID, IVSize and KID are present
+// flags 0x000002 use-subsample-encryption: every sample carries a subsample list
+type PiffSencBox struct {
+	*box
+	AlgorithmID uint32 // when flags 0x000001 is set
+	IVSize      uint8  // from the box when flags 0x000001 is set, otherwise DefaultPiffIVSize
+	KID         UUID   // when flags 0x000001 is set
+	Samples     []SencSample
+}
+
+// DefaultPiffIVSize is the IV size assumed when a PIFF senc box does not carry one.
+// The real value is in the track's tenc box, which the senc decoder cannot see.
+const DefaultPiffIVSize = 8
+
+type SencSample struct {
+	IV         []byte
+	Subsamples []SencSubsample
+}
+
+type SencSubsample struct {
+	BytesOfClearData     uint16
+	BytesOfProtectedData uint32
+}
+
+func (b *PiffSencBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.IVSize = DefaultPiffIVSize
+	if b.flags[2]&0x01 != 0 {
+		b.AlgorithmID = c.U24()
+		b.IVSize = c.U8()
+		copy(b.KID[:], c.Bytes(16))
+	}
+	count := c.U32()
+	if c.Err() != nil {
+		return c.Err()
+	}
+	if b.IVSize != 0 && b.IVSize != 8 && b.IVSize != 16 {
+		return fmt.Errorf("%w: senc IV size %d", ErrBadValue, b.IVSize)
+	}
+	subsamples := b.flags[2]&0x02 != 0
+	recSize := uint64(b.IVSize)
+	if subsamples {
+		recSize += 2 // subsample_count
+	}
+	if recSize == 0 {
+		// empty records would let a forged count run on without reading anything
+		recSize = 1
+	}
+	if uint64(count)*recSize > uint64(c.Remaining()) {
+		return fmt.Errorf("%w: %d samples with %d byte IVs, %d bytes left", ErrTruncated, count, b.IVSize, c.Remaining())
+	}
+	ps := b.state()
+	if err := ps.allocateSamples(uint64(count), int(b.IVSize)+24); err != nil {
+		return err
+	}
+	b.Samples = make([]SencSample, 0, count)
+	for i := 0; i < int(count) && c.Err() == nil; i++ {
+		if err := ps.tick(i); err != nil {
+			return err
+		}
+		s := SencSample{IV: c.Bytes(int(b.IVSize))}
+		if subsamples {
+			n := int(c.U16())
+			for j := 0; j < n && c.Err() == nil; j++ {
+				ss := SencSubsample{BytesOfClearData: c.U16()}
+				ss.BytesOfProtectedData = c.U32()
+				s.Subsamples = append(s.Subsamples, ss)
+			}
+		}
+		b.Samples = append(b.Samples, s)
+	}
+	return c.Err()
+}
+
+func (b *PiffSencBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.displayType()+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("flg:%02x%02x%02x ", b.flags[0], b.flags[1], b.flags[2])
+	if b.flags[2]&0x01 != 0 {
+		fmt.Printf("algID:%d KID:%s ", b.AlgorithmID, b.KID)
+	}
+	fmt.Printf("ivSize:%d samples:%d", b.IVSize, len(b.Samples))
+	fmt.Printf("\n")
+}
+func (b *PiffSencBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// XmpBox holds an XMP metadata packet
+type XmpBox struct {
+	*box
+	Packet string // the XML of the packet, as stored
+}
+
+func (b *XmpBox) parse() error {
+	b.Packet = string(b.raw)
+	return nil
+}
+
+func (b *XmpBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.displayType()+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("packet: %d bytes", len(b.Packet))
+	fmt.Printf("\n")
+}
+func (b *XmpBox) PrintRecursive() {
+	printTree(b)
+}
@@ -0,0 +1,224 @@
+package bmff
+
+import (
+	"fmt"
+	"math"
+)
+
+// sample description box and the sample entries it holds
+
+func init() {
+	RegisterBox("stsd", []string{"stbl"}, parsedBy(func(b *box) parser { return &StsdBox{box: b} }))
+	visual := parsedBy(func(b *box) parser { return &VisualSampleEntry{box: b} })
+	for _, format := range []string{"avc1", "avc3", "hvc1", "hev1", "mp4v", "encv"} {
+		RegisterBox(format, []string{"stsd"}, visual)
+	}
+	audio := parsedBy(func(b *box) parser { return &AudioSampleEntry{box: b} })
+	for _, format := range []string{"mp4a", "enca"} {
+		RegisterBox(format, []string{"stsd"}, audio)
+	}
+	RegisterBox("mp4s", []string{"stsd"}, parsedBy(func(b *box) parser { return &SampleEntry{box: b} }))
+}
+
+// *********************************************************
+// Sample Description box: one sample entry per coding format used by the track.
+// Entries of formats without a decoder stay as raw sub boxes.
+type StsdBox struct {
+	*box
+	EntryCount uint32
+	Entries    []Box // in file order.. *VisualSampleEntry, *AudioSampleEntry, *SampleEntry or raw
+}
+
+func (b *StsdBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.EntryCount = c.U32()
+	if c.Err() != nil {
+		return c.Err()
+	}
+	err := b.parseChildren(c.Rest(), keepRaw, func(child Box) {
+		b.Entries = append(b.Entries, child)
+	})
+	if err == nil && len(b.Entries) != int(b.EntryCount) {
+		err = fmt.Errorf("%w: entry_count is %d, %d entries found", ErrBadValue, b.EntryCount, len(b.Entries))
+	}
+	return err
+}
+
+func (b *StsdBox) PrintDetail() {
+	children := "   "
+	if cCount := b.GetSubBoxCount(); cCount > 0 {
+		children = fmt.Sprintf("%2d ", cCount)
+	}
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+children+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("entries:%d", b.EntryCount)
+	fmt.Printf("\n")
+}
+func (b *StsdBox) PrintRecursive() {
+	printTree(b)
+}
+
+// sampleEntryHeader reads the fields every sample entry starts with and returns
+// its data_reference_index
+func sampleEntryHeader(c *cursor) uint16 {
+	c.Skip(6) // reserved
+	return c.U16()
+}
+
+// *********************************************************
+// SampleEntry is a sample entry of a format with no fields of its own, such as mp4s
+type SampleEntry struct {
+	*box
+	DataReferenceIndex uint16 // 1 based index of the dref entry locating the samples
+
+	Esds *EsdsBox // MPEG-4 systems decoder configuration of mp4s entries
+}
+
+func (b *SampleEntry) parse() error {
+	c := newCursor(b.raw)
+	b.DataReferenceIndex = sampleEntryHeader(c)
+	if c.Err() != nil {
+		return c.Err()
+	}
+	return b.parseChildren(c.Rest(), keepRaw, func(child Box) {
+		if esds, ok := child.(*EsdsBox); ok {
+			b.Esds = esds
+		}
+	})
+}
+
+func (b *SampleEntry) PrintDetail() {
+	children := "   "
+	if cCount := b.GetSubBoxCount(); cCount > 0 {
+		children = fmt.Sprintf("%2d ", cCount)
+	}
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+children+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("dref:%d", b.DataReferenceIndex)
+	fmt.Printf("\n")
+}
+func (b *SampleEntry) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// VisualSampleEntry describes the samples of a video track (avc1, hvc1, encv...).
+// Children such as avcC, pasp or sinf follow the fixed fields.
+type VisualSampleEntry struct {
+	*box
+	DataReferenceIndex uint16
+	Width              uint16 // in pixels
+	Height             uint16
+	HorizResolution    Uint16_16 // pixels per inch, normally 72
+	VertResolution     Uint16_16
+	FrameCount         uint16 // frames per sample, normally 1
+	CompressorName     string
+	Depth              uint16 // 0x0018: colour with no alpha
+
+	AvcC *AvcCBox // H.264 configuration of avc1, avc3 and encv entries
+	HvcC *HvcCBox // HEVC configuration of hvc1, hev1 and encv entries
+	Esds *EsdsBox // MPEG-4 visual configuration of mp4v and encv entries
+}
+
+func (b *VisualSampleEntry) parse() error {
+	c := newCursor(b.raw)
+	b.DataReferenceIndex = sampleEntryHeader(c)
+	c.Skip(16) // pre_defined, reserved, pre_defined[3]
+	b.Width = c.U16()
+	b.Height = c.U16()
+	b.HorizResolution = Uint16_16(c.U32())
+	b.VertResolution = Uint16_16(c.U32())
+	c.Skip(4) // reserved
+	b.FrameCount = c.U16()
+	// a 32 byte field: the length of the name then the name, padded
+	if name := c.Bytes(32); name != nil {
+		n := int(name[0])
+		if n > 31 {
+			n = 31
+		}
+		b.CompressorName = string(name[1 : 1+n])
+	}
+	b.Depth = c.U16()
+	c.Skip(2) // pre_defined = -1
+	if c.Err() != nil {
+		return c.Err()
+	}
+	return b.parseChildren(c.Rest(), keepRaw, func(child Box) {
+		switch cb := child.(type) {
+		case *AvcCBox:
+			b.AvcC = cb
+		case *HvcCBox:
+			b.HvcC = cb
+		case *EsdsBox:
+			b.Esds = cb
+		}
+	})
+}
+
+func (b *VisualSampleEntry) PrintDetail() {
+	children := "   "
+	if cCount := b.GetSubBoxCount(); cCount > 0 {
+		children = fmt.Sprintf("%2d ", cCount)
+	}
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+children+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("dref:%d %dx%d depth:%d compressor:%q", b.DataReferenceIndex, b.Width, b.Height, b.Depth, b.CompressorName)
+	fmt.Printf("\n")
+}
+func (b *VisualSampleEntry) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// AudioSampleEntry describes the samples of a sound track (mp4a, enca...).
+// The QuickTime version 1 and 2 sound descriptions are read as well.
+type AudioSampleEntry struct {
+	*box
+	DataReferenceIndex uint16
+	Version            uint16 // 0 for ISO files, 1 or 2 for QuickTime sound descriptions
+	ChannelCount       uint16
+	SampleSize         uint16 // bits per sample
+	SampleRate         uint32 // in Hz
+
+	Esds *EsdsBox // AAC configuration of mp4a and enca entries
+}
+
+func (b *AudioSampleEntry) parse() error {
+	c := newCursor(b.raw)
+	b.DataReferenceIndex = sampleEntryHeader(c)
+	b.Version = c.U16()
+	c.Skip(6) // revision level and vendor
+	b.ChannelCount = c.U16()
+	b.SampleSize = c.U16()
+	c.Skip(4)                    // pre_defined and reserved
+	b.SampleRate = c.U32() >> 16 // 16.16 fixed point
+	switch b.Version {
+	case 1:
+		c.Skip(16) // samples per packet, bytes per packet, bytes per frame, bytes per sample
+	case 2:
+		c.Skip(4) // size of the structure
+		b.SampleRate = uint32(math.Float64frombits(c.U64()))
+		b.ChannelCount = uint16(c.U32())
+		c.Skip(4) // always 0x7f000000
+		b.SampleSize = uint16(c.U32())
+		c.Skip(12) // format specific flags, bytes and frames per packet
+	}
+	if c.Err() != nil {
+		return c.Err()
+	}
+	return b.parseChildren(c.Rest(), keepRaw, func(child Box) {
+		if esds, ok := child.(*EsdsBox); ok {
+			b.Esds = esds
+		}
+	})
+}
+
+func (b *AudioSampleEntry) PrintDetail() {
+	children := "   "
+	if cCount := b.GetSubBoxCount(); cCount > 0 {
+		children = fmt.Sprintf("%2d ", cCount)
+	}
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+children+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("dref:%d channels:%d sampleSize:%d sampleRate:%d", b.DataReferenceIndex, b.ChannelCount, b.SampleSize, b.SampleRate)
+	fmt.Printf("\n")
+}
+func (b *AudioSampleEntry) PrintRecursive() {
+	printTree(b)
+}
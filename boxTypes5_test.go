@@ -0,0 +1,119 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStsd(t *testing.T) {
+	avcC := mkBox("avcC", []byte{1, 0x64, 0, 0x1f, 0xff, 0xe0, 0})
+	pasp := mkBox("pasp", []byte{0, 0, 0, 1, 0, 0, 0, 1})
+
+	audio := make([]byte, 28)
+	audio[7] = 1
+	binary.BigEndian.PutUint16(audio[16:18], 2)
+	binary.BigEndian.PutUint16(audio[18:20], 16)
+	binary.BigEndian.PutUint32(audio[24:28], 48000<<16)
+
+	qtV1 := append([]byte{}, audio...)
+	qtV1[9] = 1
+	qtV1 = append(qtV1, make([]byte, 16)...)
+
+	qtV2 := make([]byte, 28)
+	qtV2[7] = 1
+	qtV2[9] = 2
+	binary.BigEndian.PutUint32(qtV2[24:28], 1<<16)
+	qtV2 = binary.BigEndian.AppendUint32(qtV2, 72)
+	qtV2 = binary.BigEndian.AppendUint64(qtV2, math.Float64bits(96000))
+	qtV2 = binary.BigEndian.AppendUint32(qtV2, 6)
+	qtV2 = append(qtV2, 0x7f, 0, 0, 0, 0, 0, 0, 16)
+	qtV2 = append(qtV2, make([]byte, 12)...)
+
+	tests := []struct {
+		name         string
+		stsd         []byte
+		wantEntries  []string
+		wantChannels uint16
+		wantRate     uint32
+		wantErr      error
+	}{
+		{"avc1 with children", mkStsd(mkVisualEntry("avc1", 1920, 1080, "x264", avcC, pasp)), []string{"avc1"}, 0, 0, nil},
+		{"mp4a", mkStsd(mkBox("mp4a", audio, mkBox("btrt", make([]byte, 12)))), []string{"mp4a"}, 2, 48000, nil},
+		{"QuickTime v1 sound", mkStsd(mkBox("mp4a", qtV1)), []string{"mp4a"}, 2, 48000, nil},
+		{"QuickTime v2 sound", mkStsd(mkBox("enca", qtV2)), []string{"enca"}, 6, 96000, nil},
+		{"unknown format kept raw", mkStsd(mkBox("ac-3", audio), mkVisualEntry("hev1", 1920, 1080, "")), []string{"ac-3", "hev1"}, 0, 0, nil},
+		{"truncated visual entry", mkStsd(mkBox("encv", make([]byte, 40))), nil, 0, 0, ErrTruncated},
+		{"entry count mismatch", mkBox("stsd", []byte{0, 0, 0, 0, 0, 0, 0, 2}, mkBox("mp4a", audio)), nil, 0, 0, ErrBadValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := mkStbl(tt.stsd)
+			f, _, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{Strict: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			stsd := f.Moov.TrackBoxes[0].Mdia.Minf.Stbl.Stsd
+			if stsd == nil || len(stsd.Entries) != len(tt.wantEntries) {
+				t.Fatalf("stsd = %+v, want entries %v", stsd, tt.wantEntries)
+			}
+			for i, e := range stsd.Entries {
+				if e.Type() != tt.wantEntries[i] {
+					t.Errorf("entry %d is %s, want %s", i, e.Type(), tt.wantEntries[i])
+				}
+			}
+			switch e := stsd.Entries[0].(type) {
+			case *VisualSampleEntry:
+				if e.Width != 1920 || e.Height != 1080 || e.CompressorName != "x264" || e.Depth != 0x18 || e.GetSubBoxCount() != 2 {
+					t.Errorf("visual entry = %+v with %d children", e, e.GetSubBoxCount())
+				}
+			case *AudioSampleEntry:
+				if e.ChannelCount != tt.wantChannels || e.SampleSize != 16 || e.SampleRate != tt.wantRate {
+					t.Errorf("audio entry = %+v", e)
+				}
+			}
+
+			// the entry count and the fixed fields of the entries are written back out
+			var out bytes.Buffer
+			if _, err := f.Moov.Output(&out, 10); err != nil {
+				t.Fatalf("Output() error = %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), data) {
+				t.Errorf("Output() wrote %d bytes that differ from the %d parsed", out.Len(), len(data))
+			}
+		})
+	}
+}
+
+func TestStsdFile(t *testing.T) {
+	fh, err := os.Open(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer fh.Close()
+	f, err := Parse(fh)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	video, ok := f.FindFirst("moov/trak[hdlr=vide]/mdia/minf/stbl/stsd/mp4v").(*VisualSampleEntry)
+	if !ok || video.Width != 120 || video.Height != 96 || video.Depth != 24 {
+		t.Errorf("video sample entry = %+v", video)
+	}
+	sound, ok := f.FindFirst("moov/trak[hdlr=soun]/mdia/minf/stbl/stsd/mp4a").(*AudioSampleEntry)
+	if !ok || sound.ChannelCount != 2 || sound.SampleSize != 16 || sound.SampleRate != 22050 {
+		t.Errorf("audio sample entry = %+v", sound)
+	}
+	if sound.Offset() != 4449+16 || sound.GetSubBoxCount() != 1 {
+		t.Errorf("mp4a at %d with %d children, want 4465 and 1", sound.Offset(), sound.GetSubBoxCount())
+	}
+}
@@ -0,0 +1,329 @@
+package bmff
+
+import (
+	"fmt"
+)
+
+// codec configuration boxes found in sample entries
+
+func init() {
+	RegisterBox("avcC", []string{"avc1", "avc3", "encv"}, parsedBy(func(b *box) parser { return &AvcCBox{box: b} }))
+	RegisterBox("hvcC", []string{"hvc1", "hev1", "encv"}, parsedBy(func(b *box) parser { return &HvcCBox{box: b} }))
+	RegisterBox("esds", []string{"mp4a", "enca", "mp4v", "encv", "mp4s"}, parsedBy(func(b *box) parser { return &EsdsBox{box: b} }))
+}
+
+// *********************************************************
+// AVCDecoderConfigurationRecord (ISO/IEC 14496-15 5.3.3): the H.264 parameter sets
+// needed to decode the samples of the entry
+type AvcCBox struct {
+	*box
+	ConfigurationVersion uint8
+	Profile              uint8 // profile_idc
+	ProfileCompatibility uint8 // the constraint flags
+	Level                uint8 // level_idc
+	LengthSizeMinusOne   uint8 // samples prefix each NAL unit with its length in this many bytes + 1
+	SPS                  [][]byte
+	PPS                  [][]byte
+
+	// present for the high profiles (100, 110, 122 and 144) when the record carries them
+	HasHighProfileFields bool
+	ChromaFormat         uint8
+	BitDepthLuma         uint8
+	BitDepthChroma       uint8
+	SPSExt               [][]byte
+}
+
+func (b *AvcCBox) parse() error {
+	c := newCursor(b.raw)
+	b.ConfigurationVersion = c.U8()
+	b.Profile = c.U8()
+	b.ProfileCompatibility = c.U8()
+	b.Level = c.U8()
+	b.LengthSizeMinusOne = c.U8() & 0x03
+	b.SPS = readNALArray(c, int(c.U8()&0x1f))
+	b.PPS = readNALArray(c, int(c.U8()))
+	if c.Err() != nil {
+		return c.Err()
+	}
+	// many writers leave these out, even for high profile streams
+	switch b.Profile {
+	case 100, 110, 122, 144:
+		if c.Remaining() >= 4 {
+			b.HasHighProfileFields = true
+			b.ChromaFormat = c.U8() & 0x03
+			b.BitDepthLuma = c.U8()&0x07 + 8
+			b.BitDepthChroma = c.U8()&0x07 + 8
+			b.SPSExt = readNALArray(c, int(c.U8()))
+		}
+	}
+	return c.Err()
+}
+
+// readNALArray reads count NAL units, each preceded by its 16 bit length
+func readNALArray(c *cursor, count int) [][]byte {
+	var nals [][]byte
+	for i := 0; i < count && c.Err() == nil; i++ {
+		nals = append(nals, c.Bytes(int(c.U16())))
+	}
+	return nals
+}
+
+// ParseSPS decodes the first sequence parameter set of the record
+func (b *AvcCBox) ParseSPS() (*H264SPS, error) {
+	if len(b.SPS) == 0 {
+		return nil, fmt.Errorf("%w: avcC holds no SPS", ErrBadValue)
+	}
+	return ParseH264SPS(b.SPS[0])
+}
+
+func (b *AvcCBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("profile:%d level:%d nalLength:%d sps:%d pps:%d", b.Profile, b.Level, b.LengthSizeMinusOne+1, len(b.SPS), len(b.PPS))
+	if sps, err := b.ParseSPS(); err == nil {
+		fmt.Printf(" %dx%d", sps.Width, sps.Height)
+	}
+	fmt.Printf("\n")
+}
+func (b *AvcCBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// HEVCDecoderConfigurationRecord (ISO/IEC 14496-15 8.3.3): the HEVC profile, format and
+// parameter sets needed to decode the samples of the entry
+type HvcCBox struct {
+	*box
+	ConfigurationVersion             uint8
+	GeneralProfileSpace              uint8
+	GeneralTierFlag                  bool // true for the high tier
+	GeneralProfileIdc                uint8
+	GeneralProfileCompatibilityFlags uint32
+	GeneralConstraintIndicatorFlags  uint64 // 48 bits
+	GeneralLevelIdc                  uint8  // level * 30
+	MinSpatialSegmentationIdc        uint16
+	ParallelismType                  uint8
+	ChromaFormat                     uint8 // chroma_format_idc
+	BitDepthLuma                     uint8
+	BitDepthChroma                   uint8
+	AvgFrameRate                     uint16 // in frames per 256 seconds, 0 when unspecified
+	ConstantFrameRate                uint8
+	NumTemporalLayers                uint8
+	TemporalIDNested                 bool
+	LengthSizeMinusOne               uint8 // samples prefix each NAL unit with its length in this many bytes + 1
+	Arrays                           []HvcCNALArray
+}
+
+// HvcCNALArray holds the NAL units of one type (VPS, SPS, PPS or SEI)
+type HvcCNALArray struct {
+	Complete    bool // every NAL unit of the type is in the array, none in the samples
+	NALUnitType uint8
+	NALUnits    [][]byte
+}
+
+func (b *HvcCBox) parse() error {
+	c := newCursor(b.raw)
+	b.ConfigurationVersion = c.U8()
+	v := c.U8()
+	b.GeneralProfileSpace = v >> 6
+	b.GeneralTierFlag = v&0x20 != 0
+	b.GeneralProfileIdc = v & 0x1f
+	b.GeneralProfileCompatibilityFlags = c.U32()
+	b.GeneralConstraintIndicatorFlags = uint64(c.U16())<<32 | uint64(c.U32())
+	b.GeneralLevelIdc = c.U8()
+	b.MinSpatialSegmentationIdc = c.U16() & 0x0fff
+	b.ParallelismType = c.U8() & 0x03
+	b.ChromaFormat = c.U8() & 0x03
+	b.BitDepthLuma = c.U8()&0x07 + 8
+	b.BitDepthChroma = c.U8()&0x07 + 8
+	b.AvgFrameRate = c.U16()
+	v = c.U8()
+	b.ConstantFrameRate = v >> 6
+	b.NumTemporalLayers = v >> 3 & 0x07
+	b.TemporalIDNested = v&0x04 != 0
+	b.LengthSizeMinusOne = v & 0x03
+	count := int(c.U8())
+	for i := 0; i < count && c.Err() == nil; i++ {
+		v = c.U8()
+		a := HvcCNALArray{Complete: v&0x80 != 0, NALUnitType: v & 0x3f}
+		a.NALUnits = readNALArray(c, int(c.U16()))
+		b.Arrays = append(b.Arrays, a)
+	}
+	return c.Err()
+}
+
+// NALUnits returns the NAL units of the given type from every array of the record
+func (b *HvcCBox) NALUnits(nalType uint8) [][]byte {
+	var nals [][]byte
+	for _, a := range b.Arrays {
+		if a.NALUnitType == nalType {
+			nals = append(nals, a.NALUnits...)
+		}
+	}
+	return nals
+}
+
+// ParseSPS decodes the first sequence parameter set of the record
+func (b *HvcCBox) ParseSPS() (*H265SPS, error) {
+	sps := b.NALUnits(h265NALTypeSPS)
+	if len(sps) == 0 {
+		return nil, fmt.Errorf("%w: hvcC holds no SPS", ErrBadValue)
+	}
+	return ParseH265SPS(sps[0])
+}
+
+func (b *HvcCBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("profile:%d tier:%t level:%d chroma:%d bits:%d/%d nalLength:%d arrays:%d",
+		b.GeneralProfileIdc, b.GeneralTierFlag, b.GeneralLevelIdc, b.ChromaFormat, b.BitDepthLuma, b.BitDepthChroma,
+		b.LengthSizeMinusOne+1, len(b.Arrays))
+	if sps, err := b.ParseSPS(); err == nil {
+		fmt.Printf(" %dx%d", sps.Width, sps.Height)
+	}
+	fmt.Printf("\n")
+}
+func (b *HvcCBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Elementary Stream Descriptor box (ISO/IEC 14496-14 3.1.2): the MPEG-4 ES_Descriptor
+// of the stream, holding its decoder configuration
+type EsdsBox struct {
+	*box
+	ES *ESDescriptor
+}
+
+// MPEG-4 descriptor tags (ISO/IEC 14496-1 7.2.2.1)
+const (
+	descrTagES                  = 0x03
+	descrTagDecoderConfig       = 0x04
+	descrTagDecoderSpecificInfo = 0x05
+	descrTagSLConfig            = 0x06
+)
+
+// ESDescriptor is the ES_Descriptor of an esds box.  Descriptors this package does not
+// decode are skipped.
+type ESDescriptor struct {
+	ESID           uint16
+	StreamPriority uint8
+	DependsOnESID  uint16 // 0 when the stream depends on no other
+	URL            string
+	OCRESID        uint16
+	DecoderConfig  *DecoderConfigDescriptor
+	SLConfig       *SLConfigDescriptor
+}
+
+// DecoderConfigDescriptor gives the coding format of the stream
+type DecoderConfigDescriptor struct {
+	ObjectTypeIndication uint8 // 0x40 for MPEG-4 audio, 0x66 to 0x68 for MPEG-2 AAC, 0x20 for MPEG-4 video
+	StreamType           uint8 // 0x04 visual, 0x05 audio
+	UpStream             bool
+	BufferSizeDB         uint32
+	MaxBitrate           uint32
+	AvgBitrate           uint32
+	DecoderSpecificInfo  []byte // e.g. the AudioSpecificConfig of MPEG-4 audio
+}
+
+// SLConfigDescriptor is the sync layer configuration.. always predefined 2 in MP4 files
+type SLConfigDescriptor struct {
+	Predefined uint8
+}
+
+// readDescriptor reads the header of the next descriptor and returns its tag and a
+// cursor over its body.  The size is coded in 1 to 4 bytes of 7 bits each.
+func readDescriptor(c *cursor) (uint8, *cursor) {
+	tag := c.U8()
+	size := 0
+	for i := 0; i < 4; i++ {
+		v := c.U8()
+		size = size<<7 | int(v&0x7f)
+		if v&0x80 == 0 {
+			break
+		}
+	}
+	return tag, newCursor(c.Bytes(size))
+}
+
+func (b *EsdsBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	tag, body := readDescriptor(c)
+	if c.Err() != nil {
+		return c.Err()
+	}
+	if tag != descrTagES {
+		return fmt.Errorf("%w: esds starts with descriptor tag %d", ErrBadValue, tag)
+	}
+	es := &ESDescriptor{ESID: body.U16()}
+	flags := body.U8()
+	es.StreamPriority = flags & 0x1f
+	if flags&0x80 != 0 {
+		es.DependsOnESID = body.U16()
+	}
+	if flags&0x40 != 0 {
+		es.URL = string(body.Bytes(int(body.U8())))
+	}
+	if flags&0x20 != 0 {
+		es.OCRESID = body.U16()
+	}
+	for body.Err() == nil && body.Remaining() > 0 {
+		tag, sub := readDescriptor(body)
+		switch tag {
+		case descrTagDecoderConfig:
+			es.DecoderConfig = parseDecoderConfig(sub)
+			if sub.Err() != nil {
+				return sub.Err()
+			}
+		case descrTagSLConfig:
+			es.SLConfig = &SLConfigDescriptor{Predefined: sub.U8()}
+		}
+	}
+	if body.Err() != nil {
+		return body.Err()
+	}
+	b.ES = es
+	return nil
+}
+
+func parseDecoderConfig(c *cursor) *DecoderConfigDescriptor {
+	d := &DecoderConfigDescriptor{ObjectTypeIndication: c.U8()}
+	v := c.U8()
+	d.StreamType = v >> 2
+	d.UpStream = v&0x02 != 0
+	d.BufferSizeDB = c.U24()
+	d.MaxBitrate = c.U32()
+	d.AvgBitrate = c.U32()
+	for c.Err() == nil && c.Remaining() > 0 {
+		if tag, sub := readDescriptor(c); tag == descrTagDecoderSpecificInfo {
+			d.DecoderSpecificInfo = sub.Rest()
+		}
+	}
+	return d
+}
+
+// AudioSpecificConfig decodes the decoder specific info of an MPEG-4 or MPEG-2 AAC stream
+func (b *EsdsBox) AudioSpecificConfig() (*AudioSpecificConfig, error) {
+	if b.ES == nil || b.ES.DecoderConfig == nil {
+		return nil, fmt.Errorf("%w: esds has no decoder config", ErrBadValue)
+	}
+	switch dc := b.ES.DecoderConfig; dc.ObjectTypeIndication {
+	case 0x40, 0x66, 0x67, 0x68:
+		return ParseAudioSpecificConfig(dc.DecoderSpecificInfo)
+	default:
+		return nil, fmt.Errorf("%w: object type indication 0x%02x is not AAC", ErrBadValue, dc.ObjectTypeIndication)
+	}
+}
+
+func (b *EsdsBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	if b.ES != nil && b.ES.DecoderConfig != nil {
+		dc := b.ES.DecoderConfig
+		fmt.Printf("ES:%d objectType:0x%02x streamType:%d avgBitrate:%d", b.ES.ESID, dc.ObjectTypeIndication, dc.StreamType, dc.AvgBitrate)
+		if asc, err := b.AudioSpecificConfig(); err == nil {
+			fmt.Printf(" %s %dHz channels:%d", asc.Profile(), asc.SampleRate(), asc.Channels)
+		}
+	}
+	fmt.Printf("\n")
+}
+func (b *EsdsBox) PrintRecursive() {
+	printTree(b)
+}
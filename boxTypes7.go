@@ -0,0 +1,427 @@
+package bmff
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// sample table boxes: the per sample timing, location and properties of a track
+
+func init() {
+	RegisterBox("stts", []string{"stbl"}, parsedBy(func(b *box) parser { return &SttsBox{box: b} }))
+	RegisterBox("ctts", []string{"stbl"}, parsedBy(func(b *box) parser { return &CttsBox{box: b} }))
+	RegisterBox("stsc", []string{"stbl"}, parsedBy(func(b *box) parser { return &StscBox{box: b} }))
+	RegisterBox("stsz", []string{"stbl"}, parsedBy(func(b *box) parser { return &StszBox{box: b} }))
+	RegisterBox("stz2", []string{"stbl"}, parsedBy(func(b *box) parser { return &Stz2Box{box: b} }))
+	RegisterBox("stco", []string{"stbl"}, parsedBy(func(b *box) parser { return &StcoBox{box: b} }))
+	RegisterBox("co64", []string{"stbl"}, parsedBy(func(b *box) parser { return &Co64Box{box: b} }))
+	RegisterBox("stss", []string{"stbl"}, parsedBy(func(b *box) parser { return &StssBox{box: b} }))
+	RegisterBox("sdtp", []string{"stbl", "traf"}, parsedBy(func(b *box) parser { return &SdtpBox{box: b} }))
+}
+
+// tableCount reads the entry_count of a sample table and checks that count records of
+// recSize bytes are in the payload, then counts the memory of keeping them as records
+// of keptSize bytes
+func (b *box) tableCount(c *cursor, recSize int, keptSize uintptr) (int, error) {
+	count := c.U32()
+	if c.Err() != nil {
+		return 0, c.Err()
+	}
+	if uint64(count)*uint64(recSize) > uint64(c.Remaining()) {
+		return 0, fmt.Errorf("%w: %d entries of %d bytes, %d bytes left", ErrTruncated, count, recSize, c.Remaining())
+	}
+	if err := b.state().allocateSamples(uint64(count), int(keptSize)); err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// *********************************************************
+// Decoding Time to Sample box: runs of samples with the same duration
+type SttsEntry struct {
+	SampleCount uint32
+	SampleDelta uint32 // duration of each sample of the run, in the media timescale
+}
+
+type SttsBox struct {
+	*box
+	Entries []SttsEntry
+}
+
+func (b *SttsBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	count, err := b.tableCount(c, 8, unsafe.Sizeof(SttsEntry{}))
+	if err != nil {
+		return err
+	}
+	ps := b.state()
+	b.Entries = make([]SttsEntry, count)
+	var total uint64
+	for i := range b.Entries {
+		if err := ps.tick(i); err != nil {
+			return err
+		}
+		b.Entries[i] = SttsEntry{SampleCount: c.U32(), SampleDelta: c.U32()}
+		// the runs are only 8 bytes but they can add up to far more samples..
+		// the whole table must stay within MaxSamplesPerRun
+		total += uint64(b.Entries[i].SampleCount)
+		if err := ps.allocateSamples(total, 0); err != nil {
+			return err
+		}
+	}
+	return c.Err()
+}
+
+// SampleCount returns the number of samples the table covers
+func (b *SttsBox) SampleCount() uint64 {
+	var n uint64
+	for _, e := range b.Entries {
+		n += uint64(e.SampleCount)
+	}
+	return n
+}
+
+func (b *SttsBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("entries:%d samples:%d", len(b.Entries), b.SampleCount())
+	fmt.Printf("\n")
+}
+func (b *SttsBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Composition Time to Sample box: runs of samples with the same composition offset
+// (PTS - DTS).  Version 0 offsets are unsigned, version 1 offsets are signed.
+type CttsEntry struct {
+	SampleCount  uint32
+	SampleOffset int64 // in the media timescale
+}
+
+type CttsBox struct {
+	*box
+	Entries []CttsEntry
+}
+
+func (b *CttsBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	count, err := b.tableCount(c, 8, unsafe.Sizeof(CttsEntry{}))
+	if err != nil {
+		return err
+	}
+	ps := b.state()
+	b.Entries = make([]CttsEntry, count)
+	for i := range b.Entries {
+		if err := ps.tick(i); err != nil {
+			return err
+		}
+		e := CttsEntry{SampleCount: c.U32()}
+		if offset := c.U32(); b.version == 0 {
+			e.SampleOffset = int64(offset)
+		} else {
+			e.SampleOffset = int64(int32(offset))
+		}
+		b.Entries[i] = e
+	}
+	return c.Err()
+}
+
+func (b *CttsBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("v%d entries:%d", b.version, len(b.Entries))
+	fmt.Printf("\n")
+}
+func (b *CttsBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Sample To Chunk box: runs of chunks holding the same number of samples
+type StscEntry struct {
+	FirstChunk             uint32 // numbered from 1
+	SamplesPerChunk        uint32
+	SampleDescriptionIndex uint32 // of the stsd entry, numbered from 1
+}
+
+type StscBox struct {
+	*box
+	Entries []StscEntry
+}
+
+func (b *StscBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	count, err := b.tableCount(c, 12, unsafe.Sizeof(StscEntry{}))
+	if err != nil {
+		return err
+	}
+	ps := b.state()
+	b.Entries = make([]StscEntry, count)
+	for i := range b.Entries {
+		if err := ps.tick(i); err != nil {
+			return err
+		}
+		b.Entries[i] = StscEntry{FirstChunk: c.U32(), SamplesPerChunk: c.U32(), SampleDescriptionIndex: c.U32()}
+	}
+	return c.Err()
+}
+
+func (b *StscBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("entries:%d", len(b.Entries))
+	fmt.Printf("\n")
+}
+func (b *StscBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Sample Size box: a size shared by every sample, or one size per sample
+type StszBox struct {
+	*box
+	SampleSize  uint32 // of every sample.. 0 when Sizes gives them
+	SampleCount uint32
+	Sizes       []uint32
+}
+
+func (b *StszBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.SampleSize = c.U32()
+	if b.SampleSize != 0 {
+		b.SampleCount = c.U32()
+		if err := c.Err(); err != nil {
+			return err
+		}
+		// no table to allocate, but readers still walk every sample
+		return b.state().allocateSamples(uint64(b.SampleCount), 0)
+	}
+	count, err := b.tableCount(c, 4, unsafe.Sizeof(uint32(0)))
+	if err != nil {
+		return err
+	}
+	b.SampleCount = uint32(count)
+	ps := b.state()
+	b.Sizes = make([]uint32, count)
+	for i := range b.Sizes {
+		if err := ps.tick(i); err != nil {
+			return err
+		}
+		b.Sizes[i] = c.U32()
+	}
+	return c.Err()
+}
+
+func (b *StszBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("samples:%d size:%d", b.SampleCount, b.SampleSize)
+	fmt.Printf("\n")
+}
+func (b *StszBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Compact Sample Size box: one size per sample in 4, 8 or 16 bits
+type Stz2Box struct {
+	*box
+	FieldSize uint8
+	Sizes     []uint32
+}
+
+func (b *Stz2Box) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	c.Skip(3)        // reserved
+	b.FieldSize = c.U8()
+	count := c.U32()
+	if c.Err() != nil {
+		return c.Err()
+	}
+	switch b.FieldSize {
+	case 4, 8, 16:
+	default:
+		return fmt.Errorf("%w: stz2 field size %d", ErrBadValue, b.FieldSize)
+	}
+	need := (uint64(count)*uint64(b.FieldSize) + 7) / 8
+	if need > uint64(c.Remaining()) {
+		return fmt.Errorf("%w: %d entries of %d bits, %d bytes left", ErrTruncated, count, b.FieldSize, c.Remaining())
+	}
+	ps := b.state()
+	if err := ps.allocateSamples(uint64(count), int(unsafe.Sizeof(uint32(0)))); err != nil {
+		return err
+	}
+	b.Sizes = make([]uint32, count)
+	var packed byte
+	for i := range b.Sizes {
+		if err := ps.tick(i); err != nil {
+			return err
+		}
+		switch b.FieldSize {
+		case 4:
+			// two sizes per byte, the first in the upper nibble
+			if i%2 == 0 {
+				packed = c.U8()
+				b.Sizes[i] = uint32(packed >> 4)
+			} else {
+				b.Sizes[i] = uint32(packed & 0xf)
+			}
+		case 8:
+			b.Sizes[i] = uint32(c.U8())
+		case 16:
+			b.Sizes[i] = uint32(c.U16())
+		}
+	}
+	return c.Err()
+}
+
+func (b *Stz2Box) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("samples:%d bits:%d", len(b.Sizes), b.FieldSize)
+	fmt.Printf("\n")
+}
+func (b *Stz2Box) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Chunk Offset box: the file offset of each chunk in 32 bits
+type StcoBox struct {
+	*box
+	ChunkOffsets []uint32
+}
+
+func (b *StcoBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	count, err := b.tableCount(c, 4, unsafe.Sizeof(uint32(0)))
+	if err != nil {
+		return err
+	}
+	ps := b.state()
+	b.ChunkOffsets = make([]uint32, count)
+	for i := range b.ChunkOffsets {
+		if err := ps.tick(i); err != nil {
+			return err
+		}
+		b.ChunkOffsets[i] = c.U32()
+	}
+	return c.Err()
+}
+
+func (b *StcoBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("chunks:%d", len(b.ChunkOffsets))
+	fmt.Printf("\n")
+}
+func (b *StcoBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Chunk Large Offset box: the file offset of each chunk in 64 bits
+type Co64Box struct {
+	*box
+	ChunkOffsets []uint64
+}
+
+func (b *Co64Box) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	count, err := b.tableCount(c, 8, unsafe.Sizeof(uint64(0)))
+	if err != nil {
+		return err
+	}
+	ps := b.state()
+	b.ChunkOffsets = make([]uint64, count)
+	for i := range b.ChunkOffsets {
+		if err := ps.tick(i); err != nil {
+			return err
+		}
+		b.ChunkOffsets[i] = c.U64()
+	}
+	return c.Err()
+}
+
+func (b *Co64Box) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("chunks:%d", len(b.ChunkOffsets))
+	fmt.Printf("\n")
+}
+func (b *Co64Box) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Sync Sample box: the samples that are random access points.  When a track has no
+// stss every sample is one.
+type StssBox struct {
+	*box
+	SampleNumbers []uint32 // numbered from 1, in increasing order
+}
+
+func (b *StssBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	count, err := b.tableCount(c, 4, unsafe.Sizeof(uint32(0)))
+	if err != nil {
+		return err
+	}
+	ps := b.state()
+	b.SampleNumbers = make([]uint32, count)
+	for i := range b.SampleNumbers {
+		if err := ps.tick(i); err != nil {
+			return err
+		}
+		b.SampleNumbers[i] = c.U32()
+		if i > 0 && b.SampleNumbers[i] <= b.SampleNumbers[i-1] {
+			return fmt.Errorf("%w: sync sample %d follows %d", ErrBadValue, b.SampleNumbers[i], b.SampleNumbers[i-1])
+		}
+	}
+	return c.Err()
+}
+
+func (b *StssBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("sync samples:%d", len(b.SampleNumbers))
+	fmt.Printf("\n")
+}
+func (b *StssBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Independent and Disposable Samples box: one entry per sample, the count is that of
+// stsz or trun.  Each field is 0 when unknown, then 1 for yes and 2 for no.
+type SdtpEntry struct {
+	IsLeading     uint8 // 3: leading, but decodable
+	DependsOn     uint8 // 2: an I picture
+	IsDependedOn  uint8 // 2: disposable
+	HasRedundancy uint8
+}
+
+type SdtpBox struct {
+	*box
+	Entries []SdtpEntry
+}
+
+func (b *SdtpBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	count := c.Remaining()
+	ps := b.state()
+	if err := ps.allocateSamples(uint64(count), int(unsafe.Sizeof(SdtpEntry{}))); err != nil {
+		return err
+	}
+	b.Entries = make([]SdtpEntry, count)
+	for i := range b.Entries {
+		if err := ps.tick(i); err != nil {
+			return err
+		}
+		v := c.U8()
+		b.Entries[i] = SdtpEntry{IsLeading: v >> 6, DependsOn: v >> 4 & 3, IsDependedOn: v >> 2 & 3, HasRedundancy: v & 3}
+	}
+	return c.Err()
+}
+
+func (b *SdtpBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("samples:%d", len(b.Entries))
+	fmt.Printf("\n")
+}
+func (b *SdtpBox) PrintRecursive() {
+	printTree(b)
+}
@@ -0,0 +1,220 @@
+package bmff
+
+import (
+	"bytes"
+	"fmt"
+	"unsafe"
+)
+
+// edit list boxes: how the media timeline of a track is laid on the movie timeline, and
+// data reference boxes: which file holds the media
+
+func init() {
+	RegisterBox("edts", []string{"trak"}, parsedBy(func(b *box) parser { return &EdtsBox{box: b} }))
+	RegisterBox("elst", []string{"edts"}, parsedBy(func(b *box) parser { return &ElstBox{box: b} }))
+	RegisterBox("dref", []string{"dinf"}, parsedBy(func(b *box) parser { return &DrefBox{box: b} }))
+	RegisterBox("url ", []string{"dref"}, parsedBy(func(b *box) parser { return &DataEntryUrlBox{box: b} }))
+	RegisterBox("urn ", []string{"dref"}, parsedBy(func(b *box) parser { return &DataEntryUrnBox{box: b} }))
+}
+
+// *********************************************************
+// Edit box, container
+type EdtsBox struct {
+	*box
+	Elst *ElstBox
+}
+
+func (b *EdtsBox) parse() error {
+	return b.parseChildren(b.raw, nil, func(child Box) {
+		switch cb := child.(type) {
+		case *ElstBox:
+			b.Elst = cb
+		}
+	})
+}
+
+// *********************************************************
+// Edit List box: segments of the media played one after another
+type ElstEntry struct {
+	SegmentDuration uint64   // in the movie timescale of mvhd
+	MediaTime       int64    // where the segment starts in the media timescale.. -1 for an empty edit
+	MediaRate       Int16_16 // 1 to play, 0 to hold the picture at MediaTime
+}
+
+type ElstBox struct {
+	*box
+	Entries []ElstEntry
+}
+
+func (b *ElstBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	recSize := 12
+	if b.version == 1 {
+		recSize = 20
+	}
+	count, err := b.tableCount(c, recSize, unsafe.Sizeof(ElstEntry{}))
+	if err != nil {
+		return err
+	}
+	ps := b.state()
+	b.Entries = make([]ElstEntry, count)
+	for i := range b.Entries {
+		if err := ps.tick(i); err != nil {
+			return err
+		}
+		e := &b.Entries[i]
+		if b.version == 1 {
+			e.SegmentDuration = c.U64()
+			e.MediaTime = int64(c.U64())
+		} else {
+			e.SegmentDuration = uint64(c.U32())
+			e.MediaTime = int64(int32(c.U32()))
+		}
+		e.MediaRate = Int16_16(c.U32())
+		if e.MediaTime < -1 {
+			return fmt.Errorf("%w: edit %d starts at media time %d", ErrBadValue, i, e.MediaTime)
+		}
+		if e.MediaRate < 0 {
+			return fmt.Errorf("%w: edit %d has media rate %v", ErrBadValue, i, e.MediaRate)
+		}
+	}
+	return c.Err()
+}
+
+func (b *ElstBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("v%d edits:%d", b.version, len(b.Entries))
+	fmt.Printf("\n")
+}
+func (b *ElstBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Data Reference box: the places the media of a track is in.  Sample entries refer to
+// its entries by their 1 based data_reference_index.
+type DrefBox struct {
+	*box
+	EntryCount uint32
+	Entries    []Box // in file order.. *DataEntryUrlBox, *DataEntryUrnBox or raw
+}
+
+func (b *DrefBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	b.EntryCount = c.U32()
+	if c.Err() != nil {
+		return c.Err()
+	}
+	err := b.parseChildren(c.Rest(), keepRaw, func(child Box) {
+		b.Entries = append(b.Entries, child)
+	})
+	if err == nil && len(b.Entries) != int(b.EntryCount) {
+		err = fmt.Errorf("%w: entry_count is %d, %d entries found", ErrBadValue, b.EntryCount, len(b.Entries))
+	}
+	return err
+}
+
+func (b *DrefBox) PrintDetail() {
+	children := "   "
+	if cCount := b.GetSubBoxCount(); cCount > 0 {
+		children = fmt.Sprintf("%2d ", cCount)
+	}
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+children+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("entries:%d", b.EntryCount)
+	fmt.Printf("\n")
+}
+func (b *DrefBox) PrintRecursive() {
+	printTree(b)
+}
+
+// DataReference describes where the samples referring to one dref entry are
+type DataReference struct {
+	Type          string // box type of the entry: "url ", "urn " or another
+	SelfContained bool   // the media is in the file holding the movie box
+	Name          string // urn entries only
+	Location      string // URL of the file holding the media when not self-contained
+}
+
+// Reference returns the dref entry at index, numbered from 1 as in sample entries
+func (b *DrefBox) Reference(index uint16) (DataReference, error) {
+	if index == 0 || int(index) > len(b.Entries) {
+		return DataReference{}, fmt.Errorf("%w: data reference %d of %d", ErrBadValue, index, len(b.Entries))
+	}
+	switch e := b.Entries[index-1].(type) {
+	case *DataEntryUrlBox:
+		return DataReference{Type: e.Type(), SelfContained: e.SelfContained, Location: e.Location}, nil
+	case *DataEntryUrnBox:
+		return DataReference{Type: e.Type(), SelfContained: e.SelfContained, Name: e.Name, Location: e.Location}, nil
+	default:
+		// e.g. a QuickTime alis entry, which is self-contained by the same flag
+		raw := e.Raw()
+		return DataReference{Type: e.Type(), SelfContained: len(raw) >= 4 && raw[3]&dataEntrySelfContained != 0}, nil
+	}
+}
+
+// the flag of data entries whose media is in the same file as the movie box
+const dataEntrySelfContained = 0x01
+
+// *********************************************************
+// Data Entry URL box
+type DataEntryUrlBox struct {
+	*box
+	SelfContained bool
+	Location      string // empty when self-contained
+}
+
+func (b *DataEntryUrlBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	if c.Err() != nil {
+		return c.Err()
+	}
+	b.SelfContained = b.flags[2]&dataEntrySelfContained != 0
+	if !b.SelfContained {
+		b.Location = string(bytes.TrimRight(c.Rest(), "\x00"))
+	}
+	return nil
+}
+
+func (b *DataEntryUrlBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	if b.SelfContained {
+		fmt.Printf("self-contained")
+	} else {
+		fmt.Printf("location:%s", b.Location)
+	}
+	fmt.Printf("\n")
+}
+func (b *DataEntryUrlBox) PrintRecursive() {
+	printTree(b)
+}
+
+// *********************************************************
+// Data Entry URN box
+type DataEntryUrnBox struct {
+	*box
+	SelfContained bool
+	Name          string
+	Location      string // optional
+}
+
+func (b *DataEntryUrnBox) parse() error {
+	c := b.fullBox() // consume [0:4] => version and flags
+	if c.Err() != nil {
+		return c.Err()
+	}
+	b.SelfContained = b.flags[2]&dataEntrySelfContained != 0
+	rest := c.Rest()
+	name, location, _ := bytes.Cut(rest, []byte{0})
+	b.Name = string(name)
+	b.Location = string(bytes.TrimRight(location, "\x00"))
+	return nil
+}
+
+func (b *DataEntryUrnBox) PrintDetail() {
+	fmt.Printf("%-16s %-19s %7d ", b.Tag.String(), b.Tag.Indent()+"   "+b.boxtype+" "+b.typeNotDecoded.String(), b.size)
+	fmt.Printf("name:%s location:%s", b.Name, b.Location)
+	fmt.Printf("\n")
+}
+func (b *DataEntryUrnBox) PrintRecursive() {
+	printTree(b)
+}
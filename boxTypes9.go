@@ -4,9 +4,12 @@ import (
 	"efmt"
 	"encoding/binary"
 	"fmt"
-	"klog"
 )
 
+func init() {
+	RegisterBox("emsg", []string{TopLevel}, parsedBy(func(b *box) parser { return &EmsgBox{box: b} }))
+}
+
 // type box struct {
 // 	Tag       *efmt.Ntag // for structured identification and printing
 // 	boxtype   string     // from 4 byte field
@@ -166,24 +169,7 @@ func (b *EmsgBox) PrintDetail() {
 }
 
 func (b *EmsgBox) PrintRecursive() {
-	var bx Box
-	bx = b
-	bx.PrintDetail()
-	b.ResetSubBox()
-	b1, err := b.GetSubBox()
-	for err == nil {
-		b1.PrintRecursive()
-		b1, err = b.GetSubBox()
-	}
-}
-
-func parseString(input []byte, start int) (result string, next int) {
-	for idx, char := range input[start:] {
-		if char == 0 {
-			return string(input[start : start+idx]), start + idx + 1
-		}
-	}
-	return "", start
+	printTree(b)
 }
 
 // encode null terminated string and return output length
@@ -195,23 +181,15 @@ func encodeString(output []byte, startOffset int, oStr string) (length int) {
 }
 
 func (b *EmsgBox) parse() error {
-	b.parseFullBoxExt() // consume [0:4] of the raw payload of the base box => version and flags
-	offset := 4
-	b.scheme_id_uri, offset = parseString(b.raw, offset)
-	if b.scheme_id_uri == "" {
-		return kl.KWarn(klog.KlrBadData, "string not terminated\n")
-	}
-
-	b.value, offset = parseString(b.raw, offset)
-	if b.value == "" {
-		return kl.KWarn(klog.KlrBadData, "string not terminated\n")
-	}
-	b.timescale = binary.BigEndian.Uint32(b.raw[offset : offset+4])
-	b.presentation_time_delta = binary.BigEndian.Uint32(b.raw[offset+4 : offset+8])
-	b.event_duration = binary.BigEndian.Uint32(b.raw[offset+8 : offset+12])
-	b.id = binary.BigEndian.Uint32(b.raw[offset+12 : offset+16])
-	b.message_data = string(b.raw[offset+16:])
-	return nil
+	c := b.fullBox() // consume [0:4] of the raw payload of the base box => version and flags
+	b.scheme_id_uri = c.CString()
+	b.value = c.CString()
+	b.timescale = c.U32()
+	b.presentation_time_delta = c.U32()
+	b.event_duration = c.U32()
+	b.id = c.U32()
+	b.message_data = string(c.Rest())
+	return c.Err()
 }
 
 func (b *EmsgBox) Encode() (encodeSize int, er error) {
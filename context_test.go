@@ -0,0 +1,90 @@
+package bmff
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// cancelAfter is a context that reports itself cancelled from the n-th Err call on
+type cancelAfter struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfter) Err() error {
+	if c.n--; c.n < 0 {
+		return context.Canceled
+	}
+	return nil
+}
+
+// cancellingReader cancels its context once more than limit bytes have been read.
+// It returns at most 4KB per read, like a network connection.
+type cancellingReader struct {
+	r      io.Reader
+	read   int
+	limit  int
+	cancel context.CancelFunc
+}
+
+func (c *cancellingReader) Read(p []byte) (int, error) {
+	if len(p) > 4096 {
+		p = p[:4096]
+	}
+	n, err := c.r.Read(p)
+	if c.read += n; c.read > c.limit {
+		c.cancel()
+	}
+	return n, err
+}
+
+func TestParseContext(t *testing.T) {
+	simple, err := os.ReadFile(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+
+	t.Run("already cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		f, _, err := ParseContext(ctx, bytes.NewReader(simple), ParseOptions{})
+		if err != context.Canceled || f == nil || f.GetSubBoxCount() != 0 {
+			t.Errorf("ParseContext() = %v, error %v, want an empty file and context.Canceled", f, err)
+		}
+	})
+
+	t.Run("cancelled while reading mdat", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		r := &cancellingReader{r: bytes.NewReader(simple), limit: 10000, cancel: cancel}
+		f, _, err := ParseContext(ctx, r, ParseOptions{})
+		if err != context.Canceled {
+			t.Fatalf("error = %v, want context.Canceled", err)
+		}
+		if f.Ftyp == nil || f.Moov == nil || len(f.Moov.TrackBoxes) != 4 || f.Mdat != nil {
+			t.Errorf("partial file should hold ftyp and the whole moov only")
+		}
+	})
+
+	t.Run("cancelled inside moov", func(t *testing.T) {
+		ctx := &cancelAfter{Context: context.Background(), n: 10}
+		f, _, err := ParseContext(ctx, bytes.NewReader(simple), ParseOptions{})
+		if err != context.Canceled {
+			t.Fatalf("error = %v, want context.Canceled", err)
+		}
+		if f.Moov == nil || len(f.Moov.TrackBoxes) == 4 {
+			t.Errorf("partial file should hold a partly decoded moov")
+		}
+	})
+
+	t.Run("not cancelled", func(t *testing.T) {
+		f, _, err := ParseContext(context.Background(), bytes.NewReader(simple), ParseOptions{})
+		if err != nil || f.Mdat == nil {
+			t.Errorf("ParseContext() error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// cursor reads big endian fields from a box payload with bounds checking.
+// The first read past the end sets a sticky ErrTruncated error; from then on every
+// read returns zero values, so a decoder can read all of its fields and check Err once.
+type cursor struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func newCursor(buf []byte) *cursor {
+	return &cursor{buf: buf}
+}
+
+// take returns the next n bytes, or nil when fewer than n remain
+func (c *cursor) take(n int) []byte {
+	if c.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(c.buf)-c.pos {
+		c.err = fmt.Errorf("%w: %d bytes needed at payload offset %d, %d left", ErrTruncated, n, c.pos, len(c.buf)-c.pos)
+		return nil
+	}
+	p := c.buf[c.pos : c.pos+n]
+	c.pos += n
+	return p
+}
+
+func (c *cursor) U8() uint8 {
+	if p := c.take(1); p != nil {
+		return p[0]
+	}
+	return 0
+}
+
+func (c *cursor) U16() uint16 {
+	if p := c.take(2); p != nil {
+		return binary.BigEndian.Uint16(p)
+	}
+	return 0
+}
+
+func (c *cursor) U24() uint32 {
+	if p := c.take(3); p != nil {
+		return uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+	}
+	return 0
+}
+
+func (c *cursor) U32() uint32 {
+	if p := c.take(4); p != nil {
+		return binary.BigEndian.Uint32(p)
+	}
+	return 0
+}
+
+func (c *cursor) U64() uint64 {
+	if p := c.take(8); p != nil {
+		return binary.BigEndian.Uint64(p)
+	}
+	return 0
+}
+
+// UVersioned reads the 32 bit (version 0) or 64 bit (any other version) form of a field
+func (c *cursor) UVersioned(version uint8) uint64 {
+	if version == 0 {
+		return uint64(c.U32())
+	}
+	return c.U64()
+}
+
+// FourCC reads a 4 character code such as a box type or brand
+func (c *cursor) FourCC() string {
+	return string(c.take(4))
+}
+
+// CString reads a null terminated string, consuming the terminator
+func (c *cursor) CString() string {
+	if c.err != nil {
+		return ""
+	}
+	end := bytes.IndexByte(c.buf[c.pos:], 0)
+	if end < 0 {
+		c.err = fmt.Errorf("%w: string at payload offset %d is not terminated", ErrTruncated, c.pos)
+		return ""
+	}
+	s := string(c.buf[c.pos : c.pos+end])
+	c.pos += end + 1
+	return s
+}
+
+// Bytes returns the next n bytes.  The slice shares the payload's memory.
+func (c *cursor) Bytes(n int) []byte {
+	return c.take(n)
+}
+
+// Skip steps over n bytes
+func (c *cursor) Skip(n int) {
+	c.take(n)
+}
+
+// Rest returns everything not read yet
+func (c *cursor) Rest() []byte {
+	return c.take(c.Remaining())
+}
+
+// Remaining returns the number of unread bytes
+func (c *cursor) Remaining() int {
+	if c.err != nil {
+		return 0
+	}
+	return len(c.buf) - c.pos
+}
+
+// Pos returns the number of bytes read so far
+func (c *cursor) Pos() int {
+	return c.pos
+}
+
+// Err returns the first error met, nil if every read was in bounds
+func (c *cursor) Err() error {
+	return c.err
+}
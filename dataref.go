@@ -0,0 +1,91 @@
+package bmff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// DataResolver opens the file an external data reference points to, so the samples
+// stored there can be read.  ref.Location is as written in the dref, often a URL relative
+// to the movie file.
+type DataResolver func(ref DataReference) (io.ReaderAt, error)
+
+// dataSource is an external file holding samples of a track, opened on first use
+type dataSource struct {
+	t    *Track
+	ref  DataReference
+	once sync.Once
+	r    io.ReaderAt
+	err  error
+}
+
+func (d *dataSource) reader() (io.ReaderAt, error) {
+	d.once.Do(func() {
+		if d.t.resolver == nil {
+			d.err = fmt.Errorf("%w: no resolver for external data %q", ErrMissingBox, d.ref.Location)
+			return
+		}
+		d.r, d.err = d.t.resolver(d.ref)
+	})
+	return d.r, d.err
+}
+
+// SetDataResolver sets the function opening the files of the track's external data
+// references.  Without one, reading samples stored outside the movie file fails.
+func (t *Track) SetDataResolver(resolve DataResolver) {
+	t.resolver = resolve
+	for desc, src := range t.sources {
+		t.sources[desc] = &dataSource{t: t, ref: src.ref}
+	}
+}
+
+// sampleEntryDataReference returns the data_reference_index of a sample entry, decoded
+// or not
+func sampleEntryDataReference(entry Box) uint16 {
+	switch e := entry.(type) {
+	case *VisualSampleEntry:
+		return e.DataReferenceIndex
+	case *AudioSampleEntry:
+		return e.DataReferenceIndex
+	case *SampleEntry:
+		return e.DataReferenceIndex
+	}
+	if raw := entry.Raw(); len(raw) >= 8 {
+		return binary.BigEndian.Uint16(raw[6:8])
+	}
+	return 0
+}
+
+// findSources notes the sample descriptions whose samples are outside the movie file.
+// Without a dref every sample is taken to be in the movie file.
+func (t *Track) findSources() error {
+	stbl := t.stbl()
+	minf := t.Trak.Mdia.Minf
+	if stbl.Stsd == nil || minf.Dinf == nil || minf.Dinf.Dref == nil {
+		return nil
+	}
+	for i, entry := range stbl.Stsd.Entries {
+		ref, err := minf.Dinf.Dref.Reference(sampleEntryDataReference(entry))
+		if err != nil {
+			return fmt.Errorf("sample description %d: %w", i+1, err)
+		}
+		if ref.SelfContained {
+			continue
+		}
+		if t.sources == nil {
+			t.sources = map[uint32]*dataSource{}
+		}
+		t.sources[uint32(i+1)] = &dataSource{t: t, ref: ref}
+	}
+	return nil
+}
+
+// External reports whether the sample is stored outside the movie file, and where
+func (s *Sample) External() (DataReference, bool) {
+	if s.src == nil {
+		return DataReference{}, false
+	}
+	return s.src.ref, true
+}
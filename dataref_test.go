@@ -0,0 +1,122 @@
+package bmff
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDref(t *testing.T) {
+	selfContained := mkBox("url ", []byte{0, 0, 0, 1})
+	external := mkBox("url ", append([]byte{0, 0, 0, 0}, "media/audio.mp4\x00"...))
+	urn := mkBox("urn ", append([]byte{0, 0, 0, 0}, "urn:x-media:1\x00http://example.com/a.mp4"...))
+	alis := mkBox("alis", []byte{0, 0, 0, 1})
+
+	tests := []struct {
+		name    string
+		dref    []byte
+		want    []DataReference
+		wantErr error
+	}{
+		{"self-contained", mkDref(selfContained), []DataReference{{Type: "url ", SelfContained: true}}, nil},
+		{"url, urn and alis", mkDref(external, urn, alis), []DataReference{
+			{Type: "url ", Location: "media/audio.mp4"},
+			{Type: "urn ", Name: "urn:x-media:1", Location: "http://example.com/a.mp4"},
+			{Type: "alis", SelfContained: true},
+		}, nil},
+		{"entry count mismatch", mkBox("dref", []byte{0, 0, 0, 0, 0, 0, 0, 2}, selfContained), nil, ErrBadValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _, err := ParseWithOptions(bytes.NewReader(mkMinf(22050, mkBox("dinf", tt.dref))), ParseOptions{Strict: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			dref := f.Moov.TrackBoxes[0].Mdia.Minf.Dinf.Dref
+			for i, want := range tt.want {
+				if got, err := dref.Reference(uint16(i + 1)); err != nil || got != want {
+					t.Errorf("Reference(%d) = %+v, %v, want %+v", i+1, got, err, want)
+				}
+			}
+			if _, err := dref.Reference(uint16(len(tt.want) + 1)); !errors.Is(err, ErrBadValue) {
+				t.Errorf("Reference() past the last entry: error %v", err)
+			}
+		})
+	}
+}
+
+func TestDrefFile(t *testing.T) {
+	fh, err := os.Open(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer fh.Close()
+	f, err := Parse(fh)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	for _, trak := range f.Moov.TrackBoxes {
+		dinf := trak.Mdia.Minf.Dinf
+		if dinf == nil || dinf.Dref == nil {
+			t.Fatalf("track %d has no dref", trak.Tkhd.TrackID)
+		}
+		if ref, err := dinf.Dref.Reference(1); err != nil || !ref.SelfContained {
+			t.Errorf("track %d: Reference(1) = %+v, %v", trak.Tkhd.TrackID, ref, err)
+		}
+	}
+}
+
+func TestExternalSamples(t *testing.T) {
+	audio := make([]byte, 28)
+	audio[7] = 2 // the second dref entry
+	dinf := mkBox("dinf", mkDref(mkBox("url ", []byte{0, 0, 0, 1}), mkBox("url ", append([]byte{0, 0, 0, 0}, "audio.raw"...))))
+	stbl := mkBox("stbl", mkStsd(mkBox("mp4a", audio)), mkTable("stts", 0, 2, 1024),
+		mkBox("stsc", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 1}), mkStsz(3, 5),
+		mkBox("stco", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 4}))
+	f, _, err := ParseWithOptions(bytes.NewReader(mkMinf(22050, dinf, stbl)), ParseOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions() error = %v", err)
+	}
+	track := f.Tracks()[0]
+	if track.Err() != nil {
+		t.Fatalf("Err() = %v", track.Err())
+	}
+
+	it := track.Samples()
+	if !it.Next() {
+		t.Fatalf("no sample: %v", it.Err())
+	}
+	s := it.Sample()
+	if ref, ok := s.External(); !ok || ref.Location != "audio.raw" {
+		t.Errorf("External() = %+v, %v", ref, ok)
+	}
+	if _, err := s.Data(bytes.NewReader(nil)); !errors.Is(err, ErrMissingBox) {
+		t.Errorf("Data() without a resolver: error %v, want %v", err, ErrMissingBox)
+	}
+
+	var opened []string
+	track.SetDataResolver(func(ref DataReference) (io.ReaderAt, error) {
+		opened = append(opened, ref.Location)
+		return bytes.NewReader([]byte("....abcdefgh")), nil
+	})
+	want := []string{"abc", "defgh"}
+	for i, it := 0, track.Samples(); it.Next(); i++ {
+		s := it.Sample()
+		data, err := s.Data(nil)
+		if err != nil || string(data) != want[i] {
+			t.Errorf("sample %d Data() = %q, %v, want %q", i, data, err, want[i])
+		}
+	}
+	if len(opened) != 1 || opened[0] != "audio.raw" {
+		t.Errorf("resolver opened %v, want audio.raw once", opened)
+	}
+}
@@ -0,0 +1,130 @@
+package bmff
+
+import (
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// EditList maps the media time of a track's samples to the time they are presented on
+// the movie timeline, the way players apply elst.  Times are in the media timescale.
+type EditList struct {
+	edits []edit // nil without an edit list, when media and presentation time are the same
+}
+
+// edit is one elst entry converted to the media timescale
+type edit struct {
+	start     int64 // presentation time the edit begins at
+	duration  int64 // presentation time it lasts, -1 for up to the end of the media
+	mediaTime int64 // -1 for an empty edit
+	rate      Int16_16
+}
+
+// NewEditList converts elst to the media timescale.  elst may be nil for a track without
+// an edit list.
+func NewEditList(elst *ElstBox, movieTimescale, mediaTimescale uint32) (*EditList, error) {
+	if elst == nil {
+		return &EditList{}, nil
+	}
+	if movieTimescale == 0 || mediaTimescale == 0 {
+		return nil, fmt.Errorf("%w: timescales %d and %d", ErrBadValue, movieTimescale, mediaTimescale)
+	}
+	l := &EditList{edits: make([]edit, 0, len(elst.Entries))}
+	var start int64
+	for i, e := range elst.Entries {
+		d := scaleTicks(e.SegmentDuration, mediaTimescale, movieTimescale)
+		if e.SegmentDuration == 0 && i == len(elst.Entries)-1 {
+			d = -1 // fragmented files leave the length of the last edit open
+		}
+		l.edits = append(l.edits, edit{start: start, duration: d, mediaTime: e.MediaTime, rate: e.MediaRate})
+		start = addTicks(start, d)
+	}
+	return l, nil
+}
+
+// scaleTicks converts v from the timescale den to the timescale num, rounding down
+func scaleTicks(v uint64, num, den uint32) int64 {
+	hi, lo := bits.Mul64(v, uint64(num))
+	if hi >= uint64(den) {
+		return 1<<63 - 1 // too long to tell apart from forever
+	}
+	q, _ := bits.Div64(hi, lo, uint64(den))
+	if q > 1<<63-1 {
+		return 1<<63 - 1
+	}
+	return int64(q)
+}
+
+// addTicks adds the times a and b, which are not negative, saturating like scaleTicks
+func addTicks(a, b int64) int64 {
+	if b > 1<<63-1-a {
+		return 1<<63 - 1
+	}
+	return a + b
+}
+
+// Edits returns the number of edits, 0 without an edit list
+func (l *EditList) Edits() int {
+	return len(l.edits)
+}
+
+// MediaToPresentation returns the presentation time of media time t, and false when no
+// edit presents it.  The first edit presenting t wins.
+func (l *EditList) MediaToPresentation(t int64) (int64, bool) {
+	if l.edits == nil {
+		return t, true
+	}
+	for _, e := range l.edits {
+		if e.mediaTime < 0 || t < e.mediaTime {
+			continue // empty edits present no media
+		}
+		if e.rate == 0 {
+			// a dwell: the media at mediaTime is held for the length of the edit
+			if t == e.mediaTime {
+				return e.start, true
+			}
+			continue
+		}
+		// at rate r the edit presents d*r of media
+		offset := t - e.mediaTime
+		if e.duration >= 0 && offset >= scaleTicks(uint64(e.duration), uint32(e.rate), 1<<16) {
+			continue
+		}
+		return addTicks(e.start, scaleTicks(uint64(offset), 1<<16, uint32(e.rate))), true
+	}
+	return 0, false
+}
+
+// PresentationTime returns when the media time t of the track is presented, from the
+// start of the movie, and false when the edit list leaves it out or cannot be read
+func (t *Track) PresentationTime(mediaTime int64) (time.Duration, bool) {
+	if t.timeline == nil || t.edits == nil {
+		return 0, false
+	}
+	p, ok := t.edits.MediaToPresentation(mediaTime)
+	if !ok {
+		return 0, false
+	}
+	return t.timeline.ToDuration(p), true
+}
+
+// EditList returns the track's edit list, or why it cannot be read.  A track without
+// an elst gets an empty list.
+func (t *Track) EditList() (*EditList, error) {
+	if t.edits == nil && t.editErr == nil {
+		return nil, fmt.Errorf("%w: timing of track %d", ErrMissingBox, t.ID)
+	}
+	return t.edits, t.editErr
+}
+
+// EditList returns the edit list of the track, given the movie timescale of mvhd
+func (b *TrakBox) EditList(movieTimescale uint32) (*EditList, error) {
+	if b.Mdia == nil || b.Mdia.Mdhd == nil {
+		return nil, fmt.Errorf("%w: mdhd", ErrMissingBox)
+	}
+	var elst *ElstBox
+	if b.Edts != nil {
+		elst = b.Edts.Elst
+	}
+	return NewEditList(elst, movieTimescale, b.Mdia.Mdhd.TimeScale)
+}
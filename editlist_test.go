@@ -0,0 +1,127 @@
+package bmff
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestElst(t *testing.T) {
+	tests := []struct {
+		name    string
+		edts    []byte
+		want    []ElstEntry
+		wantErr error
+	}{
+		{"version 0 with an empty edit", mkBox("edts", mkElst(0, [3]int64{500, -1, 1 << 16}, [3]int64{2000, 1024, 1 << 16})),
+			[]ElstEntry{{500, -1, 1 << 16}, {2000, 1024, 1 << 16}}, nil},
+		{"version 1 dwell", mkBox("edts", mkElst(1, [3]int64{1 << 40, 1 << 33, 0})), []ElstEntry{{1 << 40, 1 << 33, 0}}, nil},
+		{"media time below -1", mkBox("edts", mkElst(0, [3]int64{500, -2, 1 << 16})), nil, ErrBadValue},
+		{"negative rate", mkBox("edts", mkElst(0, [3]int64{500, 0, -1 << 16})), nil, ErrBadValue},
+		{"truncated", mkBox("edts", mkElst(1, [3]int64{500, 0, 1 << 16})[:24]), nil, ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _, err := ParseWithOptions(bytes.NewReader(mkEditedMovie(1000, 48000, tt.edts)), ParseOptions{Strict: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			edts := f.Moov.TrackBoxes[0].Edts
+			if edts == nil || edts.Elst == nil || len(edts.Elst.Entries) != len(tt.want) {
+				t.Fatalf("edts = %+v", edts)
+			}
+			for i, e := range edts.Elst.Entries {
+				if e != tt.want[i] {
+					t.Errorf("edit %d = %+v, want %+v", i, e, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEditList(t *testing.T) {
+	elst := func(edits ...ElstEntry) *ElstBox { return &ElstBox{Entries: edits} }
+	// movie timescale 1000, media timescale 48000
+	tests := []struct {
+		name   string
+		elst   *ElstBox
+		media  int64
+		want   int64
+		wantOK bool
+	}{
+		{"no edit list", nil, 4800, 4800, true},
+		{"empty edit delays the media", elst(ElstEntry{500, -1, 1 << 16}, ElstEntry{2000, 1024, 1 << 16}), 1024, 24000, true},
+		{"last media time of an edit", elst(ElstEntry{500, -1, 1 << 16}, ElstEntry{2000, 1024, 1 << 16}), 1024 + 95999, 24000 + 95999, true},
+		{"priming cut by the edit", elst(ElstEntry{500, -1, 1 << 16}, ElstEntry{2000, 1024, 1 << 16}), 1000, 0, false},
+		{"past the edit", elst(ElstEntry{500, -1, 1 << 16}, ElstEntry{2000, 1024, 1 << 16}), 1024 + 96000, 0, false},
+		{"dwell", elst(ElstEntry{1000, 0, 0}, ElstEntry{1000, 4800, 1 << 16}), 0, 0, true},
+		{"after a dwell", elst(ElstEntry{1000, 0, 0}, ElstEntry{1000, 4800, 1 << 16}), 4800, 48000, true},
+		{"double rate", elst(ElstEntry{1000, 0, 2 << 16}), 95998, 47999, true},
+		{"past a double rate edit", elst(ElstEntry{1000, 0, 2 << 16}), 96000, 0, false},
+		{"after an edit too long to end", elst(ElstEntry{1<<64 - 1, 4800, 1 << 16}, ElstEntry{1000, 0, 1 << 16}), 0, 1<<63 - 1, true},
+		{"open last edit", elst(ElstEntry{0, 1024, 1 << 16}), 1 << 40, 1<<40 - 1024, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewEditList(tt.elst, 1000, 48000)
+			if err != nil {
+				t.Fatalf("NewEditList() error = %v", err)
+			}
+			got, ok := l.MediaToPresentation(tt.media)
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("MediaToPresentation(%d) = %d, %v, want %d, %v", tt.media, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+	if _, err := NewEditList(elst(ElstEntry{1000, 0, 1 << 16}), 0, 48000); !errors.Is(err, ErrBadValue) {
+		t.Errorf("NewEditList() with movie timescale 0: error %v", err)
+	}
+}
+
+func TestTrackPresentationTime(t *testing.T) {
+	// AAC priming: the first 2112 samples of the media are not played
+	edts := mkBox("edts", mkElst(0, [3]int64{2000, 2112, 1 << 16}))
+	f, _, err := ParseWithOptions(bytes.NewReader(mkEditedMovie(1000, 48000, edts)), ParseOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions() error = %v", err)
+	}
+	direct, err := NewTrack(f.Moov.TrackBoxes[0], 1000)
+	if err != nil {
+		t.Fatalf("NewTrack() error = %v", err)
+	}
+	for name, track := range map[string]*Track{"Tracks": f.Tracks()[0], "NewTrack": direct} {
+		if l, err := track.EditList(); err != nil || l.Edits() != 1 {
+			t.Fatalf("%s: EditList() = %+v, %v", name, l, err)
+		}
+		if d, ok := track.PresentationTime(2112 + 48000); !ok || d != time.Second {
+			t.Errorf("%s: PresentationTime() = %v, %v, want 1s", name, d, ok)
+		}
+		if _, ok := track.PresentationTime(1024); ok {
+			t.Errorf("%s: PresentationTime() of a priming sample is presented", name)
+		}
+	}
+
+	// an edit list that cannot be read is reported on its own.. the samples are not
+	// affected, and no media time passes for a presentation time
+	f, _, err = ParseWithOptions(bytes.NewReader(mkEditedMovie(0, 48000, edts)), ParseOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions() error = %v", err)
+	}
+	track := f.Tracks()[0]
+	if _, err := track.EditList(); !errors.Is(err, ErrBadValue) {
+		t.Errorf("EditList() with movie timescale 0: error %v, want %v", err, ErrBadValue)
+	}
+	if errors.Is(track.Err(), ErrBadValue) {
+		t.Errorf("Err() = %v, the edit list error leaked into the samples", track.Err())
+	}
+	if _, ok := track.PresentationTime(2112); ok {
+		t.Errorf("PresentationTime() presented without an edit list")
+	}
+}
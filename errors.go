@@ -0,0 +1,96 @@
+package bmff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrTruncated means the data ended before a box or field was complete
+	ErrTruncated = errors.New("bmff: truncated data")
+	// ErrBadSize means a box header carries a size that cannot be right
+	ErrBadSize = errors.New("bmff: invalid box size")
+	// ErrBadValue means a field holds a value its specification does not allow
+	ErrBadValue = errors.New("bmff: invalid field value")
+	// ErrMissingBox means a box needed to answer a query is not in the file
+	ErrMissingBox = errors.New("bmff: required box missing")
+	// ErrUnknownBox means no decoder is registered for a box type where it was found
+	ErrUnknownBox = errors.New("bmff: unknown box type")
+	// ErrLimitExceeded means the input went past one of the limits set in ParseOptions
+	ErrLimitExceeded = errors.New("bmff: parse limit exceeded")
+)
+
+// ParseError reports where in the stream and in the box tree parsing failed.
+// Use errors.Is on it to test for the reason, e.g. errors.Is(err, ErrTruncated).
+type ParseError struct {
+	Offset  int64  // offset from the start of the stream of the box that failed
+	Path    string // box types from the top of the file down to BoxType, e.g. "moov/trak/mdia/mdhd"
+	BoxType string // type of the box that failed.. empty if its header could not be read
+	Reason  error
+}
+
+func (e *ParseError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "box header"
+	}
+	return fmt.Sprintf("bmff: %s at offset %d: %v", path, e.Offset, e.Reason)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Reason
+}
+
+// DiagnosticsError holds the problems Parse and ParseReaderAt stepped over.  errors.Is
+// matches the reason of any of them, e.g. errors.Is(err, ErrTruncated).
+type DiagnosticsError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *DiagnosticsError) Error() string {
+	if len(e.Diagnostics) == 1 {
+		return e.Diagnostics[0].String()
+	}
+	return fmt.Sprintf("%s (and %d more problems)", e.Diagnostics[0], len(e.Diagnostics)-1)
+}
+
+func (e *DiagnosticsError) Unwrap() []error {
+	errs := make([]error, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		errs[i] = d.Err
+	}
+	return errs
+}
+
+// diagnosticsError returns the diagnostics other than unknown box types as a
+// *DiagnosticsError, nil when there are none
+func diagnosticsError(diags []Diagnostic) error {
+	var kept []Diagnostic
+	for _, d := range diags {
+		if !errors.Is(d.Err, ErrUnknownBox) {
+			kept = append(kept, d)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return &DiagnosticsError{Diagnostics: kept}
+}
+
+// readError turns the error from reading a box into a ParseError at offset 0 of the box.
+// running out of data becomes ErrTruncated.  The path is filled in by the parse.
+func readError(boxtype string, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	return &ParseError{BoxType: boxtype, Reason: err}
+}
+
+// rebase adds base to the offset of a ParseError created relative to the start of a box
+func rebase(err error, base int64) error {
+	if pe, ok := err.(*ParseError); ok {
+		pe.Offset += base
+	}
+	return err
+}
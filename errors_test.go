@@ -0,0 +1,101 @@
+package bmff
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseErrors(t *testing.T) {
+	simple, err := os.ReadFile(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	badMdia := mkBox("moov", mkBox("trak", []byte{0, 0, 0, 100, 'm', 'd', 'i', 'a', 0, 0}))
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantReason error
+		wantOffset int64
+		wantPath   string
+	}{
+		{"cut inside mdat", simple[:6000], ErrTruncated, 5724, "mdat"},
+		{"cut inside a header", simple[:5728], ErrTruncated, 5724, ""},
+		{"size smaller than header", append(mkBox("ftyp", make([]byte, 8)), 0, 0, 0, 4, 'f', 'r', 'e', 'e'), ErrBadSize, 16, "free"},
+		{"nested box overruns its parent", badMdia, ErrTruncated, 16, "moov/trak/mdia"},
+	}
+	strict := ParseOptions{Strict: true}
+	parsers := []struct {
+		name  string
+		parse func([]byte) error
+	}{
+		{"Parse", func(d []byte) error { _, _, err := ParseWithOptions(bytes.NewReader(d), strict); return err }},
+		{"ParseReaderAt", func(d []byte) error {
+			_, _, err := ParseReaderAtWithOptions(bytes.NewReader(d), int64(len(d)), strict)
+			return err
+		}},
+		{"StreamParser", func(d []byte) error {
+			p := NewStreamParserWithOptions(func(Box) error { return nil }, strict)
+			if _, err := p.Write(d); err != nil {
+				return err
+			}
+			return p.Close()
+		}},
+	}
+	for _, tt := range tests {
+		for _, p := range parsers {
+			t.Run(tt.name+"/"+p.name, func(t *testing.T) {
+				err := p.parse(tt.data)
+				if !errors.Is(err, tt.wantReason) {
+					t.Fatalf("error = %v, want %v", err, tt.wantReason)
+				}
+				var pe *ParseError
+				if !errors.As(err, &pe) {
+					t.Fatalf("error %T is not a *ParseError", err)
+				}
+				if pe.Offset != tt.wantOffset {
+					t.Errorf("Offset = %d, want %d", pe.Offset, tt.wantOffset)
+				}
+				// the stream parser cannot see inside a box it never completed
+				if p.name != "StreamParser" || tt.wantPath == "" || tt.wantPath == "free" {
+					if pe.Path != tt.wantPath {
+						t.Errorf("Path = %q, want %q", pe.Path, tt.wantPath)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestParseReportsDiagnostics(t *testing.T) {
+	badMdhd := mkBox("moov", mkBox("trak", mkBox("mdia", mkBox("mdhd", []byte{1, 0, 0, 0, 0, 0})), mkBox("xxxx", nil)))
+	parsers := []struct {
+		name  string
+		parse func([]byte) (*File_s, error)
+	}{
+		{"Parse", func(d []byte) (*File_s, error) { return Parse(bytes.NewReader(d)) }},
+		{"ParseReaderAt", func(d []byte) (*File_s, error) { return ParseReaderAt(bytes.NewReader(d), int64(len(d))) }},
+	}
+	for _, p := range parsers {
+		t.Run(p.name, func(t *testing.T) {
+			f, err := p.parse(badMdhd)
+			var de *DiagnosticsError
+			if !errors.As(err, &de) || !errors.Is(err, ErrTruncated) {
+				t.Fatalf("error = %v, want a *DiagnosticsError for %v", err, ErrTruncated)
+			}
+			// the unknown xxxx box is kept without being reported
+			if len(de.Diagnostics) != 1 || de.Diagnostics[0].Path != "moov/trak/mdia/mdhd" {
+				t.Errorf("diagnostics = %v", de.Diagnostics)
+			}
+			if f == nil || f.Moov == nil {
+				t.Errorf("the parsed file was not returned with the error")
+			}
+			if _, err := p.parse(mkBox("moov", mkBox("xxxx", nil))); err != nil {
+				t.Errorf("unknown box reported as %v", err)
+			}
+		})
+	}
+}
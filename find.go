@@ -0,0 +1,203 @@
+package bmff
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Find returns the boxes below b matching a slash separated path.  Each segment is
+//
+//	fourcc     a child of that type ("moov", "trak", "url ")
+//	*          a child of any type
+//	**         any number (including zero) of levels of descendants
+//
+// optionally followed by one or more filters applied in order:
+//
+//	[n]              only the n-th (0 based) of the matches under each parent
+//	[fourcc]         only boxes with a descendant of that type
+//	[fourcc=value]   only boxes with a descendant of that type whose value matches.
+//	                 values are the handler type of hdlr, the major brand of ftyp/styp and
+//	                 the track ID of tkhd/tfhd
+//
+// e.g. "moov/trak[hdlr=vide]/mdia/minf/stbl/stsd" or "**/traf[tfhd=2]/trun".
+// Boxes are returned in file order.  A malformed path matches nothing.
+func (b *box) Find(path string) []Box {
+	segs, ok := parseSelector(path)
+	if !ok {
+		return nil
+	}
+	nodes := []Box{b}
+	for _, seg := range segs {
+		nodes = seg.apply(nodes)
+		if len(nodes) == 0 {
+			break
+		}
+	}
+	if len(nodes) > 0 && nodes[0] == Box(b) {
+		nodes = nodes[1:] // a trailing ** also collects the starting box
+	}
+	return nodes
+}
+
+// FindFirst returns the first box matched by Find, or nil
+func (b *box) FindFirst(path string) Box {
+	if found := b.Find(path); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+type selectorFilter struct {
+	index    int    // -1 when this is a predicate
+	key      string // descendant box type
+	value    string // empty matches any value
+	hasValue bool
+}
+
+type selectorSeg struct {
+	name    string // fourcc, "*" or "**"
+	filters []selectorFilter
+}
+
+func parseSelector(path string) ([]selectorSeg, bool) {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil, false
+	}
+	var segs []selectorSeg
+	for _, part := range strings.Split(path, "/") {
+		seg := selectorSeg{name: part}
+		if open := strings.IndexByte(part, '['); open >= 0 {
+			seg.name = part[:open]
+			for rest := part[open:]; rest != ""; {
+				end := strings.IndexByte(rest, ']')
+				if rest[0] != '[' || end < 0 {
+					return nil, false
+				}
+				f, ok := parseSelectorFilter(rest[1:end])
+				if !ok {
+					return nil, false
+				}
+				seg.filters = append(seg.filters, f)
+				rest = rest[end+1:]
+			}
+		}
+		if seg.name != "*" && seg.name != "**" && len(seg.name) != 4 {
+			return nil, false
+		}
+		if seg.name == "**" && len(seg.filters) > 0 {
+			return nil, false
+		}
+		segs = append(segs, seg)
+	}
+	return segs, true
+}
+
+func parseSelectorFilter(expr string) (selectorFilter, bool) {
+	if n, err := strconv.Atoi(expr); err == nil {
+		return selectorFilter{index: n}, n >= 0
+	}
+	f := selectorFilter{index: -1, key: expr}
+	if eq := strings.IndexByte(expr, '='); eq >= 0 {
+		f.key, f.value, f.hasValue = expr[:eq], expr[eq+1:], true
+	}
+	return f, len(f.key) == 4
+}
+
+// apply steps from each of nodes to the boxes this segment selects
+func (s selectorSeg) apply(nodes []Box) []Box {
+	var out []Box
+	if s.name == "**" {
+		seen := make(map[Box]bool)
+		for _, n := range nodes {
+			collectDescendants(n, seen, &out)
+		}
+		return out
+	}
+	for _, n := range nodes {
+		var matches []Box
+		for _, c := range n.Children() {
+			if s.name == "*" || c.Type() == s.name {
+				matches = append(matches, c)
+			}
+		}
+		for _, f := range s.filters {
+			matches = f.apply(matches)
+		}
+		out = append(out, matches...)
+	}
+	return out
+}
+
+func (f selectorFilter) apply(matches []Box) []Box {
+	if f.index >= 0 {
+		if f.index < len(matches) {
+			return matches[f.index : f.index+1]
+		}
+		return nil
+	}
+	var out []Box
+	for _, m := range matches {
+		if f.matches(m) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// matches reports whether bx has a descendant of type key holding the wanted value
+func (f selectorFilter) matches(bx Box) bool {
+	for _, c := range bx.Children() {
+		if c.Type() == f.key {
+			if !f.hasValue {
+				return true
+			}
+			if v, ok := c.(interface{ selectorValue() string }); ok && v.selectorValue() == f.value {
+				return true
+			}
+		}
+		if f.matches(c) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectDescendants appends n and everything below it, in file order
+func collectDescendants(n Box, seen map[Box]bool, out *[]Box) {
+	if seen[n] {
+		return
+	}
+	seen[n] = true
+	*out = append(*out, n)
+	for _, c := range n.Children() {
+		collectDescendants(c, seen, out)
+	}
+}
+
+// values used by [fourcc=value] filters
+
+func (b *HdlrBox) selectorValue() string {
+	return fourCCString(b.handlerType)
+}
+
+func (b *FtypBox) selectorValue() string {
+	return b.MajorBrand
+}
+
+func (b *StypBox) selectorValue() string {
+	return b.MajorBrand
+}
+
+func (b *TkhdBox) selectorValue() string {
+	return strconv.FormatUint(uint64(b.TrackID), 10)
+}
+
+func (b *TfhdBox) selectorValue() string {
+	return strconv.FormatUint(uint64(b.track_ID), 10)
+}
+
+// fourCCString turns a big endian packed box/handler type back into its 4 characters
+func fourCCString(v uint32) string {
+	return string([]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)})
+}
@@ -0,0 +1,107 @@
+package bmff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	src := filepath.Join("testdata", "01_simple.mp4")
+	rF, err := os.Open(src)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", src, err)
+	}
+	defer rF.Close()
+	f, err := Parse(rF)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	vide := f.Moov.TrackBoxes[2]
+	soun := f.Moov.TrackBoxes[3]
+
+	tests := []struct {
+		path string
+		want []Box
+	}{
+		{"moov/trak", []Box{f.Moov.TrackBoxes[0], f.Moov.TrackBoxes[1], vide, soun}},
+		{"/moov/trak[2]/mdia/minf/stbl/", []Box{vide.Mdia.Minf.Stbl}},
+		{"moov/trak[hdlr=vide]", []Box{vide}},
+		{"moov/trak[hdlr=soun]/mdia/hdlr", []Box{soun.Mdia.Hdlr}},
+		{"moov/trak[tref][0]", []Box{f.Moov.TrackBoxes[1]}},
+		{"moov/trak[tkhd=101]/tkhd", []Box{soun.Tkhd}},
+		{"moov/trak[hdlr=vide][1]", nil},
+		{"**/mdhd", []Box{f.Moov.TrackBoxes[0].Mdia.Mdhd, f.Moov.TrackBoxes[1].Mdia.Mdhd, vide.Mdia.Mdhd, soun.Mdia.Mdhd}},
+		{"moov/*/mdia[1]", nil},
+		{"moov/*[5]/**/smhd", []Box{soun.Mdia.Minf.Smhd}},
+		{"moov/udta/cprt", []Box{f.Moov.Udta.Cprt}},
+		{"ftyp", []Box{f.Ftyp}},
+		{"moov/trak[hdlr=vide", nil}, // malformed
+		{"moov/trak[-1]", nil},
+		{"moov/tracks", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got := f.Find(tt.path)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Find(%q) found %d boxes, want %d", tt.path, len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Find(%q)[%d] = %s %p, want %p", tt.path, i, got[i].Type(), got[i], tt.want[i])
+				}
+			}
+		})
+	}
+	if got := vide.FindFirst("mdia/minf/stbl"); got != Box(vide.Mdia.Minf.Stbl) {
+		t.Errorf("FindFirst from a trak = %v", got)
+	}
+	if got := f.FindFirst("moof"); got != nil {
+		t.Errorf("FindFirst(moof) = %v, want nil", got)
+	}
+
+	// a Box handed out by Children() can be queried without knowing its type
+	var moov Box
+	for _, c := range f.Children() {
+		if c.Type() == "moov" {
+			moov = c
+		}
+	}
+	if moov == nil {
+		t.Fatalf("no moov among the file's children")
+	}
+	if got := moov.FindFirst("trak[hdlr=soun]/tkhd"); got != Box(soun.Tkhd) {
+		t.Errorf("FindFirst through a Box = %v", got)
+	}
+	if got := moov.Find("trak/mdia/mdhd"); len(got) != 4 || got[2] != Box(vide.Mdia.Mdhd) {
+		t.Errorf("Find through a Box found %d boxes", len(got))
+	}
+}
+
+func TestFindFragmented(t *testing.T) {
+	traf := func(trackID byte) []byte {
+		return mkBox("traf", mkBox("tfhd", []byte{0, 0, 0, 0, 0, 0, 0, trackID}), mkBox("trun", make([]byte, 8)))
+	}
+	var data []byte
+	for i := 0; i < 3; i++ {
+		data = append(data, mkBox("moof", mkBox("mfhd", make([]byte, 8)), traf(1), traf(2))...)
+		data = append(data, mkBox("mdat", make([]byte, 4))...)
+	}
+	f, err := ParseReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReaderAt() error = %v", err)
+	}
+	runs := f.Find("**/traf[tfhd=2]/trun")
+	if len(runs) != 3 {
+		t.Fatalf("found %d track 2 truns, want 3", len(runs))
+	}
+	for i, r := range runs {
+		if r != Box(f.Fragments[i].Moof.Traf[1].Trun) {
+			t.Errorf("trun %d is not from fragment %d track 2", i, i)
+		}
+	}
+	if got := len(f.Find("moof/traf")); got != 6 {
+		t.Errorf("moof/traf found %d, want 6", got)
+	}
+}
@@ -0,0 +1,88 @@
+package bmff
+
+import (
+	"bytes"
+	"efmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fuzzSeeds adds the test file and its leading boxes to the corpus
+func fuzzSeeds(f *testing.F) {
+	simple, err := os.ReadFile(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		f.Fatalf("failed to read test file: %v", err)
+	}
+	f.Add(simple[:5724]) // ftyp and moov
+	f.Add(simple[24:5724])
+	f.Add(simple[:6000]) // cut inside mdat
+	f.Add(mkFragment(1, 16))
+	f.Add(mkBox("emsg", make([]byte, 4), []byte("uri\x00val\x00"), make([]byte, 16)))
+
+	// one of each box decoded inside a trak or traf, which FuzzNewBox tries under every parent
+	esds := []byte{0, 0, 0, 0, 0x03, 0x19, 0, 1, 0, 0x04, 0x11, 0x40, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x05, 0x02, 0x12, 0x10, 0x06, 0x01, 0x02}
+	hvcC := []byte{1, 0x22, 0x20, 0, 0, 0, 0x90, 0, 0, 0, 0, 0, 153, 0xf0, 0, 0xfc, 0xfd, 0xfa, 0xfa, 0, 0, 0x0f, 1, 0xa0, 0, 1, 0, 4, 0x40, 1, 0x0c, 0x01}
+	audio := make([]byte, 28)
+	audio[7] = 1
+	senc := []byte{0, 0, 0, 2, 0, 0, 0, 1, 1, 2, 3, 4, 5, 6, 7, 8, 0, 1, 0, 16, 0, 0, 1, 0}
+	boxes := [][]byte{
+		mkTable("stts", 0, 10, 1000, 1, 500),
+		mkTable("ctts", 1, 1, 1000, 1, 0xfffffc18),
+		mkBox("stsc", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 1}),
+		mkStsz(4, 2, 6),
+		mkBox("stz2", []byte{0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 5, 0x12, 0x34, 0x50}),
+		mkBox("stco", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 64}),
+		mkBox("co64", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 64}),
+		mkStss(1, 4),
+		mkBox("sdtp", []byte{0, 0, 0, 0, 0x20, 0x18}),
+		mkStsd(mkVisualEntry("avc1", 1920, 1080, "", mkBox("avcC", []byte{1, 0x64, 0, 0x1f, 0xff, 0xe0, 0}))),
+		mkVisualEntry("hvc1", 3840, 2160, "", mkBox("hvcC", hvcC)),
+		mkBox("mp4a", audio, mkBox("esds", esds)),
+		mkBox("dinf", mkDref(mkBox("url ", []byte{0, 0, 0, 1}), mkBox("urn ", []byte{0, 0, 0, 0, 'u', 0, 'l', 0}))),
+		mkBox("edts", mkElst(1, [3]int64{1000, 2112, 1 << 16})),
+		mkUUIDBox(UUIDPiffSenc, senc),
+	}
+	for _, b := range boxes {
+		f.Add(b)
+	}
+	f.Add(mkStbl(boxes[:9]...))
+}
+
+func FuzzParse(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, opts := range []ParseOptions{{}, {Strict: true}} {
+			file, _, err := ParseWithOptions(bytes.NewReader(data), opts)
+			if err == nil {
+				// whatever was parsed must walk and write back out
+				Walk(file, func(path []Box, b Box) error { return nil })
+				file.Output(io.Discard, 100)
+			}
+			ParseReaderAtWithOptions(bytes.NewReader(data), int64(len(data)), opts)
+		}
+	})
+}
+
+// fuzzParents are the parents FuzzNewBox decodes a box under, one for each set of
+// decoders registered by this package
+var fuzzParents = []string{TopLevel, "moov", "trak", "mdia", "minf", "udta", "tref", "moof", "traf",
+	"edts", "dinf", "dref", "stbl", "stsd", "avc1", "hvc1", "mp4a", "mp4s", "schi"}
+
+func FuzzNewBox(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		b, err := NewBox(bytes.NewReader(data), efmt.NewNtag())
+		if err != nil {
+			return
+		}
+		if b.Size() > int64(len(data)) {
+			t.Fatalf("box of %d bytes read from %d bytes", b.Size(), len(data))
+		}
+		// every decoder, wherever it is registered, must cope with any payload
+		for _, parent := range fuzzParents {
+			decodeBox(parent, b)
+		}
+	})
+}
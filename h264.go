@@ -0,0 +1,236 @@
+package bmff
+
+import (
+	"fmt"
+)
+
+// H264SPS is the part of an H.264 sequence parameter set (ITU-T H.264 7.3.2.1.1)
+// describing the picture format and timing
+type H264SPS struct {
+	ProfileIdc          uint8
+	ConstraintFlags     uint8 // constraint_set0_flag in the top bit
+	LevelIdc            uint8 // level * 10, e.g. 31 for level 3.1
+	ID                  uint32
+	ChromaFormatIdc     uint32 // 0 monochrome, 1 4:2:0, 2 4:2:2, 3 4:4:4
+	SeparateColourPlane bool
+	BitDepthLuma        uint32
+	BitDepthChroma      uint32
+	Log2MaxFrameNum     uint32
+	PicOrderCntType     uint32
+	MaxNumRefFrames     uint32
+	PicWidthInMbs       uint32
+	PicHeightInMapUnits uint32
+	FrameMbsOnly        bool // false for interlaced coding
+	FrameCropLeft       uint32
+	FrameCropRight      uint32
+	FrameCropTop        uint32
+	FrameCropBottom     uint32
+	Width               uint32 // displayed luma samples, after cropping
+	Height              uint32
+	VUI                 *H264VUI // nil when the SPS carries no VUI
+}
+
+// H264VUI holds the video usability information (Annex E) of an SPS up to the timing info
+type H264VUI struct {
+	SarWidth                uint16 // sample aspect ratio, 0:0 when unspecified
+	SarHeight               uint16
+	VideoFormat             uint8
+	VideoFullRange          bool
+	ColourPrimaries         uint8 // 2 (unspecified) when not given
+	TransferCharacteristics uint8
+	MatrixCoefficients      uint8
+	TimingInfoPresent       bool
+	NumUnitsInTick          uint32
+	TimeScale               uint32
+	FixedFrameRate          bool
+}
+
+// FrameRate returns the frame rate given by the VUI timing info, 0 when the SPS has none
+func (s *H264SPS) FrameRate() float64 {
+	if s.VUI == nil || !s.VUI.TimingInfoPresent || s.VUI.NumUnitsInTick == 0 {
+		return 0
+	}
+	// a frame is two field ticks
+	return float64(s.VUI.TimeScale) / (2 * float64(s.VUI.NumUnitsInTick))
+}
+
+// sample aspect ratios of aspect_ratio_idc 1 to 16 (Table E-1)
+var h264SarTable = [...][2]uint16{
+	{0, 0}, {1, 1}, {12, 11}, {10, 11}, {16, 11}, {40, 33}, {24, 11}, {20, 11}, {32, 11},
+	{80, 33}, {18, 11}, {15, 11}, {64, 33}, {160, 99}, {4, 3}, {3, 2}, {2, 1},
+}
+
+const h264ExtendedSar = 255
+
+// profiles whose SPS carries the chroma format, bit depths and scaling matrices
+func h264HighProfile(profileIdc uint8) bool {
+	switch profileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		return true
+	}
+	return false
+}
+
+// ParseH264SPS decodes a sequence parameter set NAL unit, header byte included,
+// as found in an avcC box
+func ParseH264SPS(nal []byte) (*H264SPS, error) {
+	if len(nal) < 4 {
+		return nil, fmt.Errorf("%w: %d byte SPS", ErrTruncated, len(nal))
+	}
+	if nalType := nal[0] & 0x1f; nalType != 7 {
+		return nil, fmt.Errorf("%w: NAL unit type %d is not an SPS", ErrBadValue, nalType)
+	}
+	r := newBitReader(unescapeRBSP(nal[1:]))
+	s := &H264SPS{ChromaFormatIdc: 1, BitDepthLuma: 8, BitDepthChroma: 8}
+	s.ProfileIdc = uint8(r.U(8))
+	s.ConstraintFlags = uint8(r.U(8))
+	s.LevelIdc = uint8(r.U(8))
+	s.ID = r.UE()
+	if h264HighProfile(s.ProfileIdc) {
+		s.ChromaFormatIdc = r.UE()
+		if s.ChromaFormatIdc == 3 {
+			s.SeparateColourPlane = r.Flag()
+		}
+		s.BitDepthLuma = r.UE() + 8
+		s.BitDepthChroma = r.UE() + 8
+		if s.ChromaFormatIdc > 3 || s.BitDepthLuma > 14 || s.BitDepthChroma > 14 {
+			return nil, fmt.Errorf("%w: chroma_format_idc %d with %d/%d bit samples", ErrBadValue, s.ChromaFormatIdc, s.BitDepthLuma, s.BitDepthChroma)
+		}
+		r.Skip(1)     // qpprime_y_zero_transform_bypass_flag
+		if r.Flag() { // seq_scaling_matrix_present_flag
+			lists := 8
+			if s.ChromaFormatIdc == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists && r.Err() == nil; i++ {
+				if r.Flag() {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					skipH264ScalingList(r, size)
+				}
+			}
+		}
+	}
+	s.Log2MaxFrameNum = r.UE() + 4
+	s.PicOrderCntType = r.UE()
+	switch s.PicOrderCntType {
+	case 0:
+		r.UE() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.Skip(1) // delta_pic_order_always_zero_flag
+		r.SE()    // offset_for_non_ref_pic
+		r.SE()    // offset_for_top_to_bottom_field
+		cycle := r.UE()
+		if cycle > 255 {
+			return nil, fmt.Errorf("%w: %d reference frames in the pic order count cycle", ErrBadValue, cycle)
+		}
+		for i := uint32(0); i < cycle && r.Err() == nil; i++ {
+			r.SE() // offset_for_ref_frame
+		}
+	}
+	s.MaxNumRefFrames = r.UE()
+	r.Skip(1) // gaps_in_frame_num_value_allowed_flag
+	s.PicWidthInMbs = r.UE() + 1
+	s.PicHeightInMapUnits = r.UE() + 1
+	s.FrameMbsOnly = r.Flag()
+	if !s.FrameMbsOnly {
+		r.Skip(1) // mb_adaptive_frame_field_flag
+	}
+	r.Skip(1)     // direct_8x8_inference_flag
+	if r.Flag() { // frame_cropping_flag
+		s.FrameCropLeft = r.UE()
+		s.FrameCropRight = r.UE()
+		s.FrameCropTop = r.UE()
+		s.FrameCropBottom = r.UE()
+	}
+	if r.Flag() { // vui_parameters_present_flag
+		s.VUI = parseH264VUI(r)
+	}
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	if err := s.computeSize(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// skipH264ScalingList steps over a scaling_list() of size coefficients
+func skipH264ScalingList(r *bitReader, size int) {
+	last, next := int32(8), int32(8)
+	for j := 0; j < size && r.Err() == nil; j++ {
+		if next != 0 {
+			next = (last + r.SE() + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+func parseH264VUI(r *bitReader) *H264VUI {
+	v := &H264VUI{VideoFormat: 5, ColourPrimaries: 2, TransferCharacteristics: 2, MatrixCoefficients: 2}
+	if r.Flag() { // aspect_ratio_info_present_flag
+		idc := r.U(8)
+		switch {
+		case idc == h264ExtendedSar:
+			v.SarWidth = uint16(r.U(16))
+			v.SarHeight = uint16(r.U(16))
+		case int(idc) < len(h264SarTable):
+			v.SarWidth, v.SarHeight = h264SarTable[idc][0], h264SarTable[idc][1]
+		}
+	}
+	if r.Flag() { // overscan_info_present_flag
+		r.Skip(1) // overscan_appropriate_flag
+	}
+	if r.Flag() { // video_signal_type_present_flag
+		v.VideoFormat = uint8(r.U(3))
+		v.VideoFullRange = r.Flag()
+		if r.Flag() { // colour_description_present_flag
+			v.ColourPrimaries = uint8(r.U(8))
+			v.TransferCharacteristics = uint8(r.U(8))
+			v.MatrixCoefficients = uint8(r.U(8))
+		}
+	}
+	if r.Flag() { // chroma_loc_info_present_flag
+		r.UE() // chroma_sample_loc_type_top_field
+		r.UE() // chroma_sample_loc_type_bottom_field
+	}
+	v.TimingInfoPresent = r.Flag()
+	if v.TimingInfoPresent {
+		v.NumUnitsInTick = r.U(32)
+		v.TimeScale = r.U(32)
+		v.FixedFrameRate = r.Flag()
+	}
+	// HRD parameters and bitstream restrictions are not needed
+	return v
+}
+
+// computeSize works out the displayed size from the macroblock counts and cropping (7.4.2.1.1)
+func (s *H264SPS) computeSize() error {
+	frameHeightFactor := uint32(2)
+	if s.FrameMbsOnly {
+		frameHeightFactor = 1
+	}
+	cropUnitX, cropUnitY := uint32(1), frameHeightFactor
+	if !s.SeparateColourPlane {
+		switch s.ChromaFormatIdc {
+		case 1: // 4:2:0
+			cropUnitX, cropUnitY = 2, 2*frameHeightFactor
+		case 2: // 4:2:2
+			cropUnitX = 2
+		}
+	}
+	width := uint64(s.PicWidthInMbs) * 16
+	height := uint64(frameHeightFactor) * uint64(s.PicHeightInMapUnits) * 16
+	cropX := uint64(cropUnitX) * (uint64(s.FrameCropLeft) + uint64(s.FrameCropRight))
+	cropY := uint64(cropUnitY) * (uint64(s.FrameCropTop) + uint64(s.FrameCropBottom))
+	if cropX >= width || cropY >= height || width > 1<<20 || height > 1<<20 {
+		return fmt.Errorf("%w: %dx%d picture cropped by %dx%d", ErrBadValue, width, height, cropX, cropY)
+	}
+	s.Width = uint32(width - cropX)
+	s.Height = uint32(height - cropY)
+	return nil
+}
@@ -0,0 +1,191 @@
+package bmff
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// testSPS holds the choices mkH264SPS writes into an SPS
+type testSPS struct {
+	profile        uint8
+	chroma         uint32 // written for the high profiles only
+	scaling        bool   // write a scaling matrix with one explicit list
+	pocType        uint32
+	pocCycle       uint32 // reference frames in the pic order count cycle of pocType 1
+	widthMbs       uint32
+	heightMapUnits uint32
+	interlaced     bool
+	crop           [4]uint32 // left, right, top, bottom
+	sarIdc         uint32    // 0 for no aspect ratio info
+	sar            [2]uint32 // for sarIdc 255
+	colour         [3]uint32 // primaries, transfer, matrix.. all 0 for none
+	timing         [2]uint32 // num_units_in_tick, time_scale.. 0 for none
+}
+
+func mkH264SPS(p testSPS) []byte {
+	w := &bitWriter{}
+	w.u(8, uint32(p.profile)).u(8, 0).u(8, 40).ue(0)
+	if h264HighProfile(p.profile) {
+		w.ue(p.chroma)
+		if p.chroma == 3 {
+			w.flag(false)
+		}
+		w.ue(0).ue(0).flag(false).flag(p.scaling)
+		if p.scaling {
+			w.flag(true)
+			for j := 0; j < 16; j++ {
+				w.se(int32(j%3) - 1)
+			}
+			for i := 1; i < 8; i++ {
+				w.flag(false)
+			}
+		}
+	}
+	w.ue(0).ue(p.pocType)
+	switch p.pocType {
+	case 0:
+		w.ue(2)
+	case 1:
+		w.flag(false).se(-1).se(2).ue(p.pocCycle)
+		for i := uint32(0); i < p.pocCycle; i++ {
+			w.se(int32(i))
+		}
+	}
+	w.ue(4).flag(false).ue(p.widthMbs - 1).ue(p.heightMapUnits - 1).flag(!p.interlaced)
+	if p.interlaced {
+		w.flag(true)
+	}
+	w.flag(true)
+	cropped := p.crop != [4]uint32{}
+	w.flag(cropped)
+	if cropped {
+		w.ue(p.crop[0]).ue(p.crop[1]).ue(p.crop[2]).ue(p.crop[3])
+	}
+	vui := p.sarIdc != 0 || p.colour != [3]uint32{} || p.timing != [2]uint32{}
+	w.flag(vui)
+	if vui {
+		w.flag(p.sarIdc != 0)
+		if p.sarIdc != 0 {
+			w.u(8, p.sarIdc)
+			if p.sarIdc == 255 {
+				w.u(16, p.sar[0]).u(16, p.sar[1])
+			}
+		}
+		w.flag(false)
+		w.flag(p.colour != [3]uint32{})
+		if p.colour != [3]uint32{} {
+			w.u(3, 5).flag(false).flag(true).u(8, p.colour[0]).u(8, p.colour[1]).u(8, p.colour[2])
+		}
+		w.flag(false)
+		w.flag(p.timing != [2]uint32{})
+		if p.timing != [2]uint32{} {
+			w.u(32, p.timing[0]).u(32, p.timing[1]).flag(true)
+		}
+		w.flag(false).flag(false).flag(false).flag(false) // no HRD, no bitstream restriction
+	}
+	return w.nal(0x67)
+}
+
+func TestParseH264SPS(t *testing.T) {
+	tests := []struct {
+		name       string
+		nal        []byte
+		wantWidth  uint32
+		wantHeight uint32
+		wantRate   float64
+		wantSar    [2]uint16
+		wantErr    error
+	}{
+		{"baseline 720p", mkH264SPS(testSPS{profile: 66, widthMbs: 80, heightMapUnits: 45}), 1280, 720, 0, [2]uint16{}, nil},
+		{"high 1080p cropped, 29.97 fps", mkH264SPS(testSPS{profile: 100, chroma: 1, widthMbs: 120, heightMapUnits: 68,
+			crop: [4]uint32{0, 0, 0, 4}, sarIdc: 1, timing: [2]uint32{1001, 60000}}), 1920, 1080, 60000.0 / 2002, [2]uint16{1, 1}, nil},
+		{"interlaced 1080i", mkH264SPS(testSPS{profile: 77, widthMbs: 120, heightMapUnits: 34, interlaced: true,
+			crop: [4]uint32{0, 0, 0, 2}}), 1920, 1080, 0, [2]uint16{}, nil},
+		{"4:2:2 with scaling matrix and extended SAR", mkH264SPS(testSPS{profile: 122, chroma: 2, scaling: true,
+			widthMbs: 45, heightMapUnits: 36, crop: [4]uint32{4, 4, 0, 0}, sarIdc: 255, sar: [2]uint32{64, 45},
+			colour: [3]uint32{9, 16, 9}}), 704, 576, 0, [2]uint16{64, 45}, nil},
+		{"pic order count type 1, escaped timing", mkH264SPS(testSPS{profile: 66, pocType: 1, pocCycle: 3,
+			widthMbs: 20, heightMapUnits: 15, timing: [2]uint32{1, 50}}), 320, 240, 25, [2]uint16{}, nil},
+		{"tick too long to double in 32 bits", mkH264SPS(testSPS{profile: 66, widthMbs: 20, heightMapUnits: 15,
+			timing: [2]uint32{0x80000000, 0x80000000}}), 320, 240, 0.5, [2]uint16{}, nil},
+		{"not an SPS", []byte{0x68, 0xce, 0x38, 0x80}, 0, 0, 0, [2]uint16{}, ErrBadValue},
+		{"truncated", mkH264SPS(testSPS{profile: 100, chroma: 1, widthMbs: 120, heightMapUnits: 68})[:6], 0, 0, 0, [2]uint16{}, ErrTruncated},
+		{"pic order count cycle too long", mkH264SPS(testSPS{profile: 66, pocType: 1, pocCycle: 300,
+			widthMbs: 20, heightMapUnits: 15}), 0, 0, 0, [2]uint16{}, ErrBadValue},
+		{"cropped away", mkH264SPS(testSPS{profile: 66, widthMbs: 1, heightMapUnits: 1, crop: [4]uint32{4, 4, 0, 0}}),
+			0, 0, 0, [2]uint16{}, ErrBadValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sps, err := ParseH264SPS(tt.nal)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseH264SPS() error = %v", err)
+			}
+			if sps.Width != tt.wantWidth || sps.Height != tt.wantHeight {
+				t.Errorf("size = %dx%d, want %dx%d", sps.Width, sps.Height, tt.wantWidth, tt.wantHeight)
+			}
+			if rate := sps.FrameRate(); rate != tt.wantRate {
+				t.Errorf("FrameRate() = %f, want %f", rate, tt.wantRate)
+			}
+			if sps.VUI != nil && (sps.VUI.SarWidth != tt.wantSar[0] || sps.VUI.SarHeight != tt.wantSar[1]) {
+				t.Errorf("SAR = %d:%d, want %d:%d", sps.VUI.SarWidth, sps.VUI.SarHeight, tt.wantSar[0], tt.wantSar[1])
+			}
+		})
+	}
+}
+
+func TestAvcC(t *testing.T) {
+	sps := mkH264SPS(testSPS{profile: 100, chroma: 1, widthMbs: 120, heightMapUnits: 68, crop: [4]uint32{0, 0, 0, 4}})
+	pps := []byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0}
+	rec := []byte{1, 100, 0, 40, 0xff, 0xe1, 0, byte(len(sps))}
+	rec = append(rec, sps...)
+	rec = append(rec, 1, 0, byte(len(pps)))
+	rec = append(rec, pps...)
+	highFields := []byte{0xfd, 0xf8, 0xf8, 0}
+
+	tests := []struct {
+		name     string
+		avcC     []byte
+		wantHigh bool
+		wantErr  error
+	}{
+		{"high profile fields left out", rec, false, nil},
+		{"high profile fields", append(append([]byte{}, rec...), highFields...), true, nil},
+		{"truncated PPS", rec[:len(rec)-2], false, ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := mkStbl(mkStsd(mkVisualEntry("avc1", 1920, 1080, "", mkBox("avcC", tt.avcC))))
+			f, _, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{Strict: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			entry := f.Moov.TrackBoxes[0].Mdia.Minf.Stbl.Stsd.Entries[0].(*VisualSampleEntry)
+			avcC := entry.AvcC
+			if avcC == nil || avcC.Profile != 100 || avcC.Level != 40 || avcC.LengthSizeMinusOne != 3 ||
+				len(avcC.SPS) != 1 || len(avcC.PPS) != 1 || avcC.HasHighProfileFields != tt.wantHigh {
+				t.Fatalf("avcC = %+v", avcC)
+			}
+			if tt.wantHigh && (avcC.ChromaFormat != 1 || avcC.BitDepthLuma != 8 || avcC.BitDepthChroma != 8) {
+				t.Errorf("high profile fields = %d %d %d", avcC.ChromaFormat, avcC.BitDepthLuma, avcC.BitDepthChroma)
+			}
+			parsed, err := avcC.ParseSPS()
+			if err != nil || parsed.Width != 1920 || parsed.Height != 1080 {
+				t.Errorf("ParseSPS() = %+v, error %v", parsed, err)
+			}
+		})
+	}
+}
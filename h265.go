@@ -0,0 +1,370 @@
+package bmff
+
+import (
+	"fmt"
+)
+
+// H265SPS is the part of an HEVC sequence parameter set (ITU-T H.265 7.3.2.2.1)
+// describing the picture format, colour and timing
+type H265SPS struct {
+	VPSID                            uint8
+	MaxSubLayers                     uint8
+	GeneralProfileSpace              uint8
+	GeneralTierFlag                  bool // true for the high tier
+	GeneralProfileIdc                uint8
+	GeneralProfileCompatibilityFlags uint32
+	GeneralLevelIdc                  uint8 // level * 30, e.g. 153 for level 5.1
+	ID                               uint32
+	ChromaFormatIdc                  uint32 // 0 monochrome, 1 4:2:0, 2 4:2:2, 3 4:4:4
+	SeparateColourPlane              bool
+	PicWidthInLumaSamples            uint32
+	PicHeightInLumaSamples           uint32
+	ConfWinLeftOffset                uint32 // conformance window, in chroma sample units
+	ConfWinRightOffset               uint32
+	ConfWinTopOffset                 uint32
+	ConfWinBottomOffset              uint32
+	BitDepthLuma                     uint32
+	BitDepthChroma                   uint32
+	Log2MaxPicOrderCntLsb            uint32
+	NumShortTermRefPicSets           uint32
+	LongTermRefPicsPresent           bool
+	Width                            uint32 // displayed luma samples, inside the conformance window
+	Height                           uint32
+	VUI                              *H265VUI // nil when the SPS carries no VUI
+}
+
+// H265VUI holds the video usability information (Annex E) of an SPS up to the timing info
+type H265VUI struct {
+	SarWidth                uint16 // sample aspect ratio, 0:0 when unspecified
+	SarHeight               uint16
+	VideoFormat             uint8
+	VideoFullRange          bool
+	ColourPrimaries         uint8 // 9 for BT.2020.. 2 (unspecified) when not given
+	TransferCharacteristics uint8 // 16 for PQ (SMPTE ST 2084), 18 for HLG
+	MatrixCoefficients      uint8
+	FieldSeq                bool
+	TimingInfoPresent       bool
+	NumUnitsInTick          uint32
+	TimeScale               uint32
+}
+
+// FrameRate returns the frame rate given by the VUI timing info, 0 when the SPS has none
+func (s *H265SPS) FrameRate() float64 {
+	if s.VUI == nil || !s.VUI.TimingInfoPresent || s.VUI.NumUnitsInTick == 0 {
+		return 0
+	}
+	return float64(s.VUI.TimeScale) / float64(s.VUI.NumUnitsInTick)
+}
+
+const (
+	h265NALTypeVPS = 32
+	h265NALTypeSPS = 33
+	h265NALTypePPS = 34
+
+	h265MaxShortTermRefPicSets = 64
+	h265MaxLongTermRefPics     = 32
+	h265MaxDpbSize             = 16
+)
+
+// h265RefPicSet is a decoded st_ref_pic_set(): the POC deltas of the reference pictures
+type h265RefPicSet struct {
+	negative []int32 // DeltaPocS0, closest first
+	positive []int32 // DeltaPocS1, closest first
+}
+
+// ParseH265SPS decodes a sequence parameter set NAL unit, 2 byte header included,
+// as found in an hvcC box
+func ParseH265SPS(nal []byte) (*H265SPS, error) {
+	if len(nal) < 4 {
+		return nil, fmt.Errorf("%w: %d byte SPS", ErrTruncated, len(nal))
+	}
+	if nalType := nal[0] >> 1 & 0x3f; nalType != h265NALTypeSPS {
+		return nil, fmt.Errorf("%w: NAL unit type %d is not an SPS", ErrBadValue, nalType)
+	}
+	r := newBitReader(unescapeRBSP(nal[2:]))
+	s := &H265SPS{}
+	s.VPSID = uint8(r.U(4))
+	s.MaxSubLayers = uint8(r.U(3)) + 1
+	r.Skip(1) // sps_temporal_id_nesting_flag
+	s.parseProfileTierLevel(r)
+	s.ID = r.UE()
+	s.ChromaFormatIdc = r.UE()
+	if s.ChromaFormatIdc == 3 {
+		s.SeparateColourPlane = r.Flag()
+	}
+	s.PicWidthInLumaSamples = r.UE()
+	s.PicHeightInLumaSamples = r.UE()
+	if r.Flag() { // conformance_window_flag
+		s.ConfWinLeftOffset = r.UE()
+		s.ConfWinRightOffset = r.UE()
+		s.ConfWinTopOffset = r.UE()
+		s.ConfWinBottomOffset = r.UE()
+	}
+	s.BitDepthLuma = r.UE() + 8
+	s.BitDepthChroma = r.UE() + 8
+	s.Log2MaxPicOrderCntLsb = r.UE() + 4
+	if s.ChromaFormatIdc > 3 || s.BitDepthLuma > 16 || s.BitDepthChroma > 16 || s.Log2MaxPicOrderCntLsb > 16 {
+		return nil, fmt.Errorf("%w: chroma_format_idc %d with %d/%d bit samples, %d bit POC", ErrBadValue,
+			s.ChromaFormatIdc, s.BitDepthLuma, s.BitDepthChroma, s.Log2MaxPicOrderCntLsb)
+	}
+	first := s.MaxSubLayers - 1
+	if r.Flag() { // sps_sub_layer_ordering_info_present_flag
+		first = 0
+	}
+	for i := first; i < s.MaxSubLayers && r.Err() == nil; i++ {
+		r.UE() // sps_max_dec_pic_buffering_minus1
+		r.UE() // sps_max_num_reorder_pics
+		r.UE() // sps_max_latency_increase_plus1
+	}
+	r.UE() // log2_min_luma_coding_block_size_minus3
+	r.UE() // log2_diff_max_min_luma_coding_block_size
+	r.UE() // log2_min_luma_transform_block_size_minus2
+	r.UE() // log2_diff_max_min_luma_transform_block_size
+	r.UE() // max_transform_hierarchy_depth_inter
+	r.UE() // max_transform_hierarchy_depth_intra
+
+	if r.Flag() { // scaling_list_enabled_flag
+		if r.Flag() { // sps_scaling_list_data_present_flag
+			skipH265ScalingListData(r)
+		}
+	}
+	r.Skip(1)     // amp_enabled_flag
+	r.Skip(1)     // sample_adaptive_offset_enabled_flag
+	if r.Flag() { // pcm_enabled_flag
+		r.Skip(8) // pcm_sample_bit_depth_luma_minus1, pcm_sample_bit_depth_chroma_minus1
+		r.UE()    // log2_min_pcm_luma_coding_block_size_minus3
+		r.UE()    // log2_diff_max_min_pcm_luma_coding_block_size
+		r.Skip(1) // pcm_loop_filter_disabled_flag
+	}
+	s.NumShortTermRefPicSets = r.UE()
+	if s.NumShortTermRefPicSets > h265MaxShortTermRefPicSets {
+		return nil, fmt.Errorf("%w: %d short term reference picture sets", ErrBadValue, s.NumShortTermRefPicSets)
+	}
+	sets := make([]h265RefPicSet, 0, s.NumShortTermRefPicSets)
+	for i := 0; i < int(s.NumShortTermRefPicSets) && r.Err() == nil; i++ {
+		set, err := parseH265RefPicSet(r, sets)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	s.LongTermRefPicsPresent = r.Flag()
+	if s.LongTermRefPicsPresent {
+		n := r.UE()
+		if n > h265MaxLongTermRefPics {
+			return nil, fmt.Errorf("%w: %d long term reference pictures", ErrBadValue, n)
+		}
+		for i := uint32(0); i < n && r.Err() == nil; i++ {
+			r.Skip(int(s.Log2MaxPicOrderCntLsb)) // lt_ref_pic_poc_lsb_sps
+			r.Skip(1)                            // used_by_curr_pic_lt_sps_flag
+		}
+	}
+	r.Skip(1)     // sps_temporal_mvp_enabled_flag
+	r.Skip(1)     // strong_intra_smoothing_enabled_flag
+	if r.Flag() { // vui_parameters_present_flag
+		s.VUI = parseH265VUI(r)
+	}
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	if err := s.computeSize(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parseProfileTierLevel reads profile_tier_level(1, sps_max_sub_layers_minus1)
+func (s *H265SPS) parseProfileTierLevel(r *bitReader) {
+	s.GeneralProfileSpace = uint8(r.U(2))
+	s.GeneralTierFlag = r.Flag()
+	s.GeneralProfileIdc = uint8(r.U(5))
+	s.GeneralProfileCompatibilityFlags = r.U(32)
+	r.Skip(48) // progressive, interlaced, non packed and frame only flags, then reserved bits
+	s.GeneralLevelIdc = uint8(r.U(8))
+	subLayers := int(s.MaxSubLayers) - 1
+	profilePresent := make([]bool, subLayers)
+	levelPresent := make([]bool, subLayers)
+	for i := 0; i < subLayers; i++ {
+		profilePresent[i] = r.Flag()
+		levelPresent[i] = r.Flag()
+	}
+	if subLayers > 0 {
+		r.Skip(2 * (8 - subLayers)) // reserved_zero_2bits
+	}
+	for i := 0; i < subLayers; i++ {
+		if profilePresent[i] {
+			r.Skip(88) // sub layer profile space, tier, profile, compatibility and constraint flags
+		}
+		if levelPresent[i] {
+			r.Skip(8) // sub_layer_level_idc
+		}
+	}
+}
+
+// skipH265ScalingListData steps over a scaling_list_data()
+func skipH265ScalingListData(r *bitReader) {
+	for sizeID := 0; sizeID < 4; sizeID++ {
+		step := 1
+		if sizeID == 3 {
+			step = 3
+		}
+		for matrixID := 0; matrixID < 6 && r.Err() == nil; matrixID += step {
+			if !r.Flag() { // scaling_list_pred_mode_flag
+				r.UE() // scaling_list_pred_matrix_id_delta
+				continue
+			}
+			coefs := 1 << uint(4+sizeID<<1)
+			if coefs > 64 {
+				coefs = 64
+			}
+			if sizeID > 1 {
+				r.SE() // scaling_list_dc_coef_minus8
+			}
+			for i := 0; i < coefs && r.Err() == nil; i++ {
+				r.SE() // scaling_list_delta_coef
+			}
+		}
+	}
+}
+
+// parseH265RefPicSet reads st_ref_pic_set(len(prev)) of an SPS.  A set may be predicted
+// from the one before it, so the earlier sets are needed to know how much to read.
+func parseH265RefPicSet(r *bitReader, prev []h265RefPicSet) (h265RefPicSet, error) {
+	var set h265RefPicSet
+	if len(prev) > 0 && r.Flag() { // inter_ref_pic_set_prediction_flag
+		ref := prev[len(prev)-1]
+		sign := r.Flag()
+		absDelta := r.UE() + 1
+		if absDelta > 1<<15 {
+			return set, fmt.Errorf("%w: reference picture set predicted %d pictures away", ErrBadValue, absDelta)
+		}
+		deltaRps := int32(absDelta)
+		if sign {
+			deltaRps = -deltaRps
+		}
+		refCount := len(ref.negative) + len(ref.positive)
+		useDelta := make([]bool, refCount+1)
+		for j := range useDelta {
+			used := r.Flag()
+			useDelta[j] = used || r.Flag() // use_delta_flag is only sent when used_by_curr_pic_flag is 0
+		}
+		// the derivation of (7-61) and (7-62)
+		nNeg := len(ref.negative)
+		for j := len(ref.positive) - 1; j >= 0; j-- {
+			if d := ref.positive[j] + deltaRps; d < 0 && useDelta[nNeg+j] {
+				set.negative = append(set.negative, d)
+			}
+		}
+		if deltaRps < 0 && useDelta[refCount] {
+			set.negative = append(set.negative, deltaRps)
+		}
+		for j, p := range ref.negative {
+			if d := p + deltaRps; d < 0 && useDelta[j] {
+				set.negative = append(set.negative, d)
+			}
+		}
+		for j := nNeg - 1; j >= 0; j-- {
+			if d := ref.negative[j] + deltaRps; d > 0 && useDelta[j] {
+				set.positive = append(set.positive, d)
+			}
+		}
+		if deltaRps > 0 && useDelta[refCount] {
+			set.positive = append(set.positive, deltaRps)
+		}
+		for j, p := range ref.positive {
+			if d := p + deltaRps; d > 0 && useDelta[nNeg+j] {
+				set.positive = append(set.positive, d)
+			}
+		}
+	} else {
+		nNeg, nPos := r.UE(), r.UE()
+		if nNeg > h265MaxDpbSize || nPos > h265MaxDpbSize {
+			return set, fmt.Errorf("%w: reference picture set of %d+%d pictures", ErrBadValue, nNeg, nPos)
+		}
+		poc := int32(0)
+		for i := uint32(0); i < nNeg && r.Err() == nil; i++ {
+			poc -= int32(r.UE()) + 1 // delta_poc_s0_minus1
+			r.Skip(1)                // used_by_curr_pic_s0_flag
+			set.negative = append(set.negative, poc)
+		}
+		poc = 0
+		for i := uint32(0); i < nPos && r.Err() == nil; i++ {
+			poc += int32(r.UE()) + 1 // delta_poc_s1_minus1
+			r.Skip(1)                // used_by_curr_pic_s1_flag
+			set.positive = append(set.positive, poc)
+		}
+	}
+	if len(set.negative)+len(set.positive) > h265MaxDpbSize {
+		return set, fmt.Errorf("%w: predicted reference picture set of %d pictures", ErrBadValue, len(set.negative)+len(set.positive))
+	}
+	return set, r.Err()
+}
+
+func parseH265VUI(r *bitReader) *H265VUI {
+	v := &H265VUI{VideoFormat: 5, ColourPrimaries: 2, TransferCharacteristics: 2, MatrixCoefficients: 2}
+	if r.Flag() { // aspect_ratio_info_present_flag
+		// the aspect ratio table is shared with H.264
+		idc := r.U(8)
+		switch {
+		case idc == h264ExtendedSar:
+			v.SarWidth = uint16(r.U(16))
+			v.SarHeight = uint16(r.U(16))
+		case int(idc) < len(h264SarTable):
+			v.SarWidth, v.SarHeight = h264SarTable[idc][0], h264SarTable[idc][1]
+		}
+	}
+	if r.Flag() { // overscan_info_present_flag
+		r.Skip(1) // overscan_appropriate_flag
+	}
+	if r.Flag() { // video_signal_type_present_flag
+		v.VideoFormat = uint8(r.U(3))
+		v.VideoFullRange = r.Flag()
+		if r.Flag() { // colour_description_present_flag
+			v.ColourPrimaries = uint8(r.U(8))
+			v.TransferCharacteristics = uint8(r.U(8))
+			v.MatrixCoefficients = uint8(r.U(8))
+		}
+	}
+	if r.Flag() { // chroma_loc_info_present_flag
+		r.UE() // chroma_sample_loc_type_top_field
+		r.UE() // chroma_sample_loc_type_bottom_field
+	}
+	r.Skip(1) // neutral_chroma_indication_flag
+	v.FieldSeq = r.Flag()
+	r.Skip(1)     // frame_field_info_present_flag
+	if r.Flag() { // default_display_window_flag
+		r.UE() // def_disp_win_left_offset
+		r.UE() // def_disp_win_right_offset
+		r.UE() // def_disp_win_top_offset
+		r.UE() // def_disp_win_bottom_offset
+	}
+	v.TimingInfoPresent = r.Flag()
+	if v.TimingInfoPresent {
+		v.NumUnitsInTick = r.U(32)
+		v.TimeScale = r.U(32)
+	}
+	// POC timing, HRD parameters and bitstream restrictions are not needed
+	return v
+}
+
+// computeSize applies the conformance window (7.4.3.2.1)
+func (s *H265SPS) computeSize() error {
+	subWidth, subHeight := uint64(1), uint64(1)
+	if !s.SeparateColourPlane {
+		switch s.ChromaFormatIdc {
+		case 1: // 4:2:0
+			subWidth, subHeight = 2, 2
+		case 2: // 4:2:2
+			subWidth = 2
+		}
+	}
+	width, height := uint64(s.PicWidthInLumaSamples), uint64(s.PicHeightInLumaSamples)
+	cropX := subWidth * (uint64(s.ConfWinLeftOffset) + uint64(s.ConfWinRightOffset))
+	cropY := subHeight * (uint64(s.ConfWinTopOffset) + uint64(s.ConfWinBottomOffset))
+	if cropX >= width || cropY >= height || width > 1<<20 || height > 1<<20 {
+		return fmt.Errorf("%w: %dx%d picture cropped by %dx%d", ErrBadValue, width, height, cropX, cropY)
+	}
+	s.Width = uint32(width - cropX)
+	s.Height = uint32(height - cropY)
+	return nil
+}
@@ -0,0 +1,225 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// testHEVCSPS holds the choices mkH265SPS writes into an SPS
+type testHEVCSPS struct {
+	subLayers     int // sps_max_sub_layers_minus1 + 1, at least 1
+	chroma        uint32
+	width, height uint32
+	confWin       [4]uint32 // left, right, top, bottom
+	bitDepth      uint32
+	scaling       bool // write explicit scaling lists
+	refPicSets    bool // write four short term sets, three of them predicted
+	longTerm      uint32
+	colour        [3]uint32 // primaries, transfer, matrix.. all 0 for no VUI
+	timing        [2]uint32 // num_units_in_tick, time_scale
+}
+
+func mkH265SPS(p testHEVCSPS) []byte {
+	w := &bitWriter{}
+	maxSub := uint32(p.subLayers - 1)
+	w.u(4, 0).u(3, maxSub).flag(true)
+	// profile_tier_level: Main 10, main tier, level 5.1
+	w.u(2, 0).flag(false).u(5, 2).u(32, 0x20000000).u(16, 0x9000).u(32, 0).u(8, 153)
+	for i := uint32(0); i < maxSub; i++ {
+		w.flag(true).flag(true)
+	}
+	if maxSub > 0 {
+		w.u(int(2*(8-maxSub)), 0)
+	}
+	for i := uint32(0); i < maxSub; i++ {
+		w.u(32, 0).u(32, 0).u(24, 0).u(8, 120)
+	}
+	w.ue(0).ue(p.chroma)
+	if p.chroma == 3 {
+		w.flag(false)
+	}
+	w.ue(p.width).ue(p.height)
+	w.flag(p.confWin != [4]uint32{})
+	if p.confWin != [4]uint32{} {
+		w.ue(p.confWin[0]).ue(p.confWin[1]).ue(p.confWin[2]).ue(p.confWin[3])
+	}
+	w.ue(p.bitDepth - 8).ue(p.bitDepth - 8).ue(4) // 8 bit POC lsb
+	w.flag(true)
+	for i := uint32(0); i <= maxSub; i++ {
+		w.ue(4).ue(2).ue(0)
+	}
+	w.ue(0).ue(3).ue(0).ue(3).ue(1).ue(1)
+	w.flag(p.scaling)
+	if p.scaling {
+		w.flag(true)
+		for sizeID := 0; sizeID < 4; sizeID++ {
+			step := 1
+			if sizeID == 3 {
+				step = 3
+			}
+			for matrixID := 0; matrixID < 6; matrixID += step {
+				if matrixID%2 == 1 {
+					w.flag(false).ue(1) // copy the list before
+					continue
+				}
+				w.flag(true)
+				coefs := 1 << uint(4+sizeID<<1)
+				if coefs > 64 {
+					coefs = 64
+				}
+				if sizeID > 1 {
+					w.se(8)
+				}
+				for i := 0; i < coefs; i++ {
+					w.se(int32(i%5) - 2)
+				}
+			}
+		}
+	}
+	w.flag(false).flag(true).flag(false) // amp, sao, no pcm
+	if p.refPicSets {
+		w.ue(4)
+		// set 0: POC -1, -2 and +1
+		w.ue(2).ue(1).ue(0).flag(true).ue(0).flag(true).ue(0).flag(true)
+		// set 1 predicted from set 0 one picture later: keeps -1 and +1
+		w.flag(true).flag(false).ue(0)
+		w.flag(true).flag(false).flag(true).flag(false).flag(false).flag(true)
+		// set 2 predicted from set 1 two pictures earlier: POC -1, -2 and -3
+		w.flag(true).flag(true).ue(1)
+		w.flag(true).flag(true).flag(true)
+		// set 3 predicted from set 2: one flag per picture of set 2, plus one
+		w.flag(true).flag(false).ue(0)
+		w.flag(true).flag(true).flag(true).flag(true)
+	} else {
+		w.ue(0)
+	}
+	w.flag(p.longTerm > 0)
+	if p.longTerm > 0 {
+		w.ue(p.longTerm)
+		for i := uint32(0); i < p.longTerm; i++ {
+			w.u(8, i).flag(true)
+		}
+	}
+	w.flag(true).flag(true) // temporal mvp, strong intra smoothing
+	vui := p.colour != [3]uint32{} || p.timing != [2]uint32{}
+	w.flag(vui)
+	if vui {
+		w.flag(true).u(8, 1) // square pixels
+		w.flag(false)
+		w.flag(true).u(3, 5).flag(false).flag(true).u(8, p.colour[0]).u(8, p.colour[1]).u(8, p.colour[2])
+		w.flag(false).flag(false).flag(false).flag(false)
+		w.flag(true).ue(0).ue(0).ue(0).ue(0) // default display window
+		w.flag(p.timing != [2]uint32{})
+		if p.timing != [2]uint32{} {
+			w.u(32, p.timing[0]).u(32, p.timing[1]).flag(false).flag(false)
+		}
+		w.flag(false)
+	}
+	w.flag(false) // no extensions
+	return w.nal(h265NALTypeSPS<<1, 1)
+}
+
+func TestParseH265SPS(t *testing.T) {
+	uhd := testHEVCSPS{subLayers: 1, chroma: 1, width: 3840, height: 2160, bitDepth: 10,
+		colour: [3]uint32{9, 16, 9}, timing: [2]uint32{1001, 60000}}
+	full := uhd
+	full.subLayers, full.scaling, full.refPicSets, full.longTerm = 3, true, true, 2
+	cropped := testHEVCSPS{subLayers: 1, chroma: 1, width: 1920, height: 1088, confWin: [4]uint32{0, 0, 0, 4}, bitDepth: 8}
+
+	tests := []struct {
+		name         string
+		nal          []byte
+		wantWidth    uint32
+		wantHeight   uint32
+		wantTransfer uint8
+		wantRate     float64
+		wantErr      error
+	}{
+		{"4K HDR10", mkH265SPS(uhd), 3840, 2160, 16, 60000.0 / 1001, nil},
+		{"sub layers, scaling lists and reference picture sets", mkH265SPS(full), 3840, 2160, 16, 60000.0 / 1001, nil},
+		{"1080p conformance window", mkH265SPS(cropped), 1920, 1080, 0, 0, nil},
+		{"4:4:4 no window", mkH265SPS(testHEVCSPS{subLayers: 1, chroma: 3, width: 1280, height: 720, bitDepth: 12}), 1280, 720, 0, 0, nil},
+		{"not an SPS", []byte{h265NALTypePPS << 1, 1, 0xc1, 0x72}, 0, 0, 0, 0, ErrBadValue},
+		{"truncated", mkH265SPS(uhd)[:20], 0, 0, 0, 0, ErrTruncated},
+		{"window larger than picture", mkH265SPS(testHEVCSPS{subLayers: 1, chroma: 1, width: 64, height: 64,
+			confWin: [4]uint32{16, 16, 0, 0}, bitDepth: 8}), 0, 0, 0, 0, ErrBadValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sps, err := ParseH265SPS(tt.nal)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseH265SPS() error = %v", err)
+			}
+			if sps.Width != tt.wantWidth || sps.Height != tt.wantHeight {
+				t.Errorf("size = %dx%d, want %dx%d", sps.Width, sps.Height, tt.wantWidth, tt.wantHeight)
+			}
+			if sps.GeneralProfileIdc != 2 || sps.GeneralLevelIdc != 153 {
+				t.Errorf("profile %d level %d, want 2 and 153", sps.GeneralProfileIdc, sps.GeneralLevelIdc)
+			}
+			if tt.wantTransfer != 0 && (sps.VUI == nil || sps.VUI.TransferCharacteristics != tt.wantTransfer || sps.VUI.ColourPrimaries != 9) {
+				t.Errorf("VUI = %+v, want transfer %d", sps.VUI, tt.wantTransfer)
+			}
+			if rate := sps.FrameRate(); rate != tt.wantRate {
+				t.Errorf("FrameRate() = %f, want %f", rate, tt.wantRate)
+			}
+		})
+	}
+}
+
+func TestHvcC(t *testing.T) {
+	sps := mkH265SPS(testHEVCSPS{subLayers: 1, chroma: 1, width: 3840, height: 2160, bitDepth: 10, colour: [3]uint32{9, 18, 9}})
+	vps := []byte{h265NALTypeVPS << 1, 1, 0x0c, 0x01}
+	pps := []byte{h265NALTypePPS << 1, 1, 0xc1, 0x72, 0xb4, 0x62, 0x40}
+
+	rec := []byte{1, 0x22, 0x20, 0, 0, 0, 0x90, 0, 0, 0, 0, 0, 153, 0xf0, 0, 0xfc, 0xfd, 0xfa, 0xfa, 0, 0, 0x0f, 3}
+	for _, nal := range [][]byte{vps, sps, pps} {
+		rec = append(rec, 0x80|nal[0]>>1)
+		rec = binary.BigEndian.AppendUint16(rec, 1)
+		rec = binary.BigEndian.AppendUint16(rec, uint16(len(nal)))
+		rec = append(rec, nal...)
+	}
+
+	tests := []struct {
+		name    string
+		hvcC    []byte
+		wantErr error
+	}{
+		{"VPS, SPS and PPS", rec, nil},
+		{"truncated", rec[:len(rec)-3], ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := mkStbl(mkStsd(mkVisualEntry("hvc1", 3840, 2160, "", mkBox("hvcC", tt.hvcC))))
+			f, _, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{Strict: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			hvcC := f.Moov.TrackBoxes[0].Mdia.Minf.Stbl.Stsd.Entries[0].(*VisualSampleEntry).HvcC
+			if hvcC == nil || hvcC.GeneralProfileIdc != 2 || !hvcC.GeneralTierFlag || hvcC.GeneralLevelIdc != 153 ||
+				hvcC.ChromaFormat != 1 || hvcC.BitDepthLuma != 10 || hvcC.LengthSizeMinusOne != 3 || len(hvcC.Arrays) != 3 {
+				t.Fatalf("hvcC = %+v", hvcC)
+			}
+			if !hvcC.Arrays[0].Complete || len(hvcC.NALUnits(h265NALTypePPS)) != 1 {
+				t.Errorf("arrays = %+v", hvcC.Arrays)
+			}
+			parsed, err := hvcC.ParseSPS()
+			if err != nil || parsed.Width != 3840 || parsed.Height != 2160 || parsed.VUI.TransferCharacteristics != 18 {
+				t.Errorf("ParseSPS() = %+v, error %v", parsed, err)
+			}
+		})
+	}
+}
@@ -3,158 +3,227 @@ package bmff
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"efmt"
+	"fmt"
 	"io"
-	"klog"
-
-	"github.com/pkg/errors"
 )
 
-func readBoxes(buf []byte, tag *efmt.Ntag) <-chan *box {
-	boxes := make(chan *box, 1000)
+// boxIter reads the boxes packed in a container payload one at a time.  Each box's
+// payload is a slice of the container's, so children cost no copying.
+type boxIter struct {
+	buf  []byte
+	r    bytes.Reader // header reader, reused for every box
+	base int64        // stream offset of buf[0]
+	pos  int64        // offset in buf of the next box
+	tag  *efmt.Ntag
+	err  error
+}
+
+// newBoxIter iterates over the boxes packed in buf, which starts at offset base in the stream
+func newBoxIter(buf []byte, base int64, tag *efmt.Ntag) *boxIter {
 	newTag := tag.Clone()
 	newTag.Push()
 	//kl.KTrace("buf has %d bytes\n", len(buf))
-	r := bytes.NewReader(buf)
-	go func() {
-		for eof := false; !eof; {
-			b, err := NewBox(r, newTag)
-			newTag.Next()
-			if err != nil {
-				kReason := kl.GetRootCause()
-				switch kReason {
-				case klog.KlrEOF:
-					eof = true
-				}
-			}
-			boxes <- b
+	return &boxIter{buf: buf, base: base, tag: newTag}
+}
+
+// Next returns the next box, or nil once the payload is used up or a box could not
+// be read.  Err tells the two apart.
+func (it *boxIter) Next() *box {
+	if it.err != nil || it.pos >= int64(len(it.buf)) {
+		return nil
+	}
+	rest := it.buf[it.pos:]
+	it.r.Reset(rest)
+	b, hdrSize, err := readBoxHeader(&it.r, it.tag)
+	it.tag.Next()
+	if err == nil {
+		size := b.Size()
+		switch {
+		case b.size == 0:
+			// runs to the end of the container
+			size = int64(len(rest))
+			b.eofSize = size
+		case size < int64(hdrSize):
+			err = &ParseError{BoxType: b.boxtype,
+				Reason: fmt.Errorf("%w: size %d smaller than its %d byte header", ErrBadSize, size, hdrSize)}
+		case size > int64(len(rest)):
+			err = readError(b.boxtype, io.ErrUnexpectedEOF)
 		}
-		close(boxes)
-	}()
-	return boxes
+		if err == nil {
+			b.raw = rest[hdrSize:size:size]
+		}
+	}
+	if err != nil {
+		it.err = rebase(err, it.base+it.pos)
+		return nil
+	}
+	b.offset = it.base + it.pos
+	it.pos += b.Size()
+	return b
+}
+
+// Rest returns the part of the payload not read as boxes
+func (it *boxIter) Rest() []byte {
+	return it.buf[it.pos:]
+}
+
+// Err returns the error that ended the iteration, nil if every box was read
+func (it *boxIter) Err() error {
+	return it.err
 }
 
-// highest level parser.
+// highest level parser.  Boxes of unknown type are kept undecoded.  Any other problem
+// inside a box is stepped over as with a lenient ParseWithOptions.  Those problems
+// are then returned together as a *DiagnosticsError, along with the parsed file.
 func Parse(src io.Reader) (*File_s, error) {
-	fb := &box{}
-	f := &File_s{box: fb}
-	r := bufio.NewReader(src)
+	f, diags, err := ParseWithOptions(src, ParseOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return f, diagnosticsError(diags)
+}
 
-	topTag := efmt.NewNtag()
-	var bx Box
-	var bxFlag bool
+// ParseWithOptions parses src as Parse does, handling problems as opts asks.
+// A lenient parse returns every problem it stepped over as a Diagnostic.  Data that
+// ends in the middle of a top level box is an error in either mode; the boxes read
+// up to that point are returned with it.
+func ParseWithOptions(src io.Reader, opts ParseOptions) (*File_s, []Diagnostic, error) {
+	return ParseContext(context.Background(), src, opts)
+}
 
-readloop:
-	for {
-		b, err := NewBox(r, topTag)
-		bxFlag = false
+// ParseContext is ParseWithOptions stopping early when ctx is done.  Cancellation is
+// checked between boxes, inside large sample tables and while reading payloads.
+// A cancelled parse returns the boxes built so far along with ctx.Err().
+func ParseContext(ctx context.Context, src io.Reader, opts ParseOptions) (*File_s, []Diagnostic, error) {
+	ps := newParseState(opts)
+	ps.ctx = ctx
+	f := &File_s{box: &box{ps: ps}}
+	defer f.flushFragment()
+	r := bufio.NewReader(ctxReader{ctx: ctx, r: src})
+
+	topTag := efmt.NewNtag()
+	for offset := int64(0); ; {
+		if err := ctx.Err(); err != nil {
+			return f, ps.diags, err
+		}
+		b, err := readBox(r, topTag, ps)
 		topTag.Next()
-		if err != nil {
-			kReason := kl.GetRootCause()
-			switch kReason {
-			case klog.KlrEOF:
-				//kl.KTrace("Got to EOF on Parse")
-				if b == nil {
-					break readloop
-				}
-			}
+		if err == io.EOF {
+			break
 		}
-
 		if err != nil {
-			switch errors.Cause(err) {
-			case io.EOF:
-				if b == nil {
-					break readloop
-				}
-			default:
-				return nil, err
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return f, ps.diags, ctxErr
 			}
+			return f, ps.diags, ps.locate(rebase(err, offset), nil)
 		}
-		switch b.boxtype {
-		case "ftyp":
-			fb := &FtypBox{box: b}
-			if err := fb.parse(); err != nil {
-				return nil, err
-			}
-			f.Ftyp, bx, bxFlag = fb, fb, true
+		b.offset = offset
+		offset += b.Size()
+		if err := f.addTopBox(b); err != nil {
+			return f, ps.diags, err
+		}
+	}
 
-		case "styp":
-			sb := &StypBox{box: b}
-			if err := sb.parse(); err != nil {
-				return nil, err
-			}
-			f.Styp = sb
-			bx = sb
-			bxFlag = true
-			//f.AllBoxes = append(f.AllBoxes, b)
-			// case pdin
-			//
-		case "emsg":
-			eb := &EmsgBox{box: b}
-			if err := eb.parse(); err != nil {
-				return nil, err
-			}
-			f.Emsg = eb
-			bx = eb
-			bxFlag = true
-			//f.AllBoxes = append(f.AllBoxes, b)
-			// case pdin
-			//
-		case "moov":
-			mb := &MoovBox{box: b}
-			if err := mb.parse(); err != nil {
-				return nil, err
-			}
-			f.Moov = mb
-			bx = mb
-			bxFlag = true
-		case "moof":
-			moof := &MoofBox{box: b}
-			if err := moof.parse(); err != nil {
-				return nil, err
-			}
-			f.Moof = moof
-			bx = moof
-			bxFlag = true
-		// case mfra
-		//
-		case "mdat":
-			mdat := &MdatBox{box: b}
-			if err := mdat.parse(); err != nil {
-				return nil, err
-			}
-			f.Mdat = mdat
-			// case free
-			//
-			// case skip
-			//
-		case "meta":
-			meta := &MetaBox{box: b}
-			if err := meta.parse(); err != nil {
-				return nil, err
-			}
-			f.Meta = meta
-			// case meco
-			//
-		case "sidx":
-			sb := &SidxBox{box: b}
-			if err := sb.parse(); err != nil {
-				return nil, err
-			}
-			f.Sidx = sb
-			bx = sb
-			bxFlag = true
-		default:
-			kl.KWarn(klog.KlrNotHandled, "%s: @Top.. Unknown Type:%s\n", b.Tag.String(), b.Type())
-			b.typeNotDecoded = true
+	return f, ps.diags, nil
+}
+
+// ParseReaderAt parses the first size bytes of src without reading mdat (or any
+// other undecoded top level box) payloads into memory.  Those boxes record their
+// offset and length, and their payload is available through Payload().
+// Containers such as moov and moof are read and decoded as with Parse.
+// Problems inside boxes are reported as Parse does.
+func ParseReaderAt(src io.ReaderAt, size int64) (*File_s, error) {
+	f, diags, err := ParseReaderAtWithOptions(src, size, ParseOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return f, diagnosticsError(diags)
+}
+
+// ParseReaderAtWithOptions is ParseReaderAt handling problems as ParseWithOptions does
+func ParseReaderAtWithOptions(src io.ReaderAt, size int64, opts ParseOptions) (*File_s, []Diagnostic, error) {
+	ps := newParseState(opts)
+	f := &File_s{box: &box{ps: ps}}
+	defer f.flushFragment()
+
+	topTag := efmt.NewNtag()
+	for offset := int64(0); offset < size; {
+		b, err := newBoxAt(src, offset, size-offset, topTag, ps)
+		topTag.Next()
+		if err != nil {
+			return f, ps.diags, ps.locate(err, nil)
 		}
-		if bxFlag {
-			f.AddSubBox(bx)
-		} else {
-			f.AddSubBox(b)
+		offset += b.Size()
+		if err := f.addTopBox(b); err != nil {
+			return f, ps.diags, err
 		}
+	}
+	return f, ps.diags, nil
+}
 
+// isLazyBox reports whether a top level box is kept in the source by ParseReaderAt.
+// Only boxes with a registered decoder are read into memory.. mdat and padding never are.
+func isLazyBox(b *box) bool {
+	switch b.boxtype {
+	case "mdat", "free", "skip":
+		return true
 	}
+	return lookupDecoder(TopLevel, b) == nil
+}
+
+// decodeTopBox decodes a top level box into its registered type, reporting any
+// problem to the parse state of b.  The returned box is never nil; the error is
+// only set when the parse must stop.
+func decodeTopBox(b *box) (Box, error) {
+	ps := b.state()
+	bx, err := decodeBox(TopLevel, b)
+	if err != nil {
+		err = ps.problem(err, b)
+	}
+	return bx, err
+}
 
-	return f, nil
+// addTopBox decodes a top level box and appends it to the file.  A box that failed
+// to decode is appended as far as it got before the error is returned.
+func (f *File_s) addTopBox(b *box) error {
+	b.ps = f.state()
+	bx, err := decodeTopBox(b)
+	switch tb := bx.(type) {
+	case *FtypBox:
+		f.Ftyp = tb
+	case *StypBox:
+		f.Styp = tb
+	case *EmsgBox:
+		f.Emsg = tb
+	case *MoovBox:
+		f.Moov = tb
+	case *MoofBox:
+		f.Moof = tb
+	case *MdatBox:
+		f.Mdat = tb
+	case *MetaBox:
+		f.Meta = tb
+	case *SidxBox:
+		f.Sidx = tb
+	case *PrftBox:
+		f.Prft = tb
+	}
+	f.addFragmentBox(bx)
+	f.AddSubBox(bx)
+	return err
+}
+
+// ctxReader fails reads once its context is done, so long payload reads can be cancelled
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
 }
@@ -1,5 +1,14 @@
 package bmff
 
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
 // func readerFromFixture(t *testing.T, path string) io.Reader {
 // 	t.Helper()
 //
@@ -49,3 +58,134 @@ package bmff
 // 		})
 // 	}
 // }
+
+func TestParseReaderAt(t *testing.T) {
+	src := filepath.Join("testdata", "01_simple.mp4")
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", src, err)
+	}
+	f, err := ParseReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReaderAt() error = %v", err)
+	}
+	if f.Moov == nil || len(f.Moov.TrackBoxes) != 4 {
+		t.Fatalf("moov not decoded: %+v", f.Moov)
+	}
+	if f.Mdat == nil {
+		t.Fatalf("mdat not found")
+	}
+	if !f.Mdat.IsLazy() || len(f.Mdat.Raw()) != 0 {
+		t.Errorf("mdat payload was read into memory")
+	}
+	if off, size := f.Mdat.PayloadOffset(), f.Mdat.PayloadSize(); off != 5732 || size != 193580 {
+		t.Errorf("mdat payload at %d size %d, want 5732 size 193580", off, size)
+	}
+	payload := make([]byte, 16)
+	if _, err := f.Mdat.Payload().ReadAt(payload, 0); err != nil {
+		t.Fatalf("mdat Payload().ReadAt error = %v", err)
+	}
+	if !bytes.Equal(payload, data[5732:5748]) {
+		t.Errorf("mdat payload mismatch: got %v", payload)
+	}
+
+	// writing the lazily parsed file must reproduce the source
+	var out bytes.Buffer
+	wCnt, err := f.Output(&out, 6)
+	if err != nil {
+		t.Fatalf("Output() error = %v", err)
+	}
+	if wCnt != len(data) || !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("Output() wrote %d bytes, does not match %d byte source", wCnt, len(data))
+	}
+
+	// a box running past the end of the source is rejected
+	if _, err := ParseReaderAt(bytes.NewReader(data), int64(len(data)-1)); err == nil {
+		t.Errorf("ParseReaderAt() of truncated source succeeded")
+	}
+}
+
+func TestFragments(t *testing.T) {
+	var data []byte
+	data = append(data, mkBox("ftyp", []byte("iso6"), make([]byte, 4))...)
+	// segment 1: styp, sidx, two emsg, prft
+	data = append(data, mkBox("styp", []byte("msdh"), make([]byte, 4))...)
+	data = append(data, mkBox("sidx", make([]byte, 24))...)
+	emsg := mkBox("emsg", make([]byte, 4), []byte("uri\x00v\x00"), make([]byte, 16))
+	data = append(data, emsg...)
+	data = append(data, emsg...)
+	data = append(data, mkBox("prft", make([]byte, 20))...)
+	data = append(data, mkFragment(1, 10)...)
+	// fragments 2 and 3 have no segment level boxes
+	data = append(data, mkFragment(2, 20)...)
+	data = append(data, mkFragment(3, 30)...)
+
+	f, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(f.Fragments) != 3 {
+		t.Fatalf("got %d fragments, want 3", len(f.Fragments))
+	}
+	first := f.Fragments[0]
+	if first.Styp == nil || len(first.Sidx) != 1 || len(first.Emsg) != 2 || first.Prft == nil {
+		t.Errorf("fragment 0 segment boxes not grouped: %+v", first)
+	}
+	for idx, frag := range f.Fragments {
+		if frag.Moof == nil || frag.Moof.Mfhd == nil || frag.Moof.Mfhd.sequence_number != uint32(idx+1) {
+			t.Errorf("fragment %d: bad moof %+v", idx, frag.Moof)
+			continue
+		}
+		if frag.Mdat == nil || frag.Mdat.Size() != int64(8+10*(idx+1)) {
+			t.Errorf("fragment %d: bad mdat %+v", idx, frag.Mdat)
+		}
+		if idx > 0 && (frag.Styp != nil || frag.Sidx != nil || frag.Emsg != nil || frag.Prft != nil) {
+			t.Errorf("fragment %d: unexpected segment boxes %+v", idx, frag)
+		}
+	}
+	if f.Moof != f.Fragments[2].Moof || f.Mdat != f.Fragments[2].Mdat {
+		t.Errorf("Moof/Mdat do not point at the last fragment")
+	}
+
+	// a segment ending with an emsg and a sidx keeps them in a fragment without a moof
+	data = append(data, emsg...)
+	data = append(data, mkBox("sidx", make([]byte, 24))...)
+	f, err = ParseReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("ParseReaderAt() error = %v", err)
+	}
+	if len(f.Fragments) != 4 {
+		t.Fatalf("got %d fragments, want 4", len(f.Fragments))
+	}
+	if last := f.Fragments[3]; last.Moof != nil || last.Mdat != nil || len(last.Emsg) != 1 || len(last.Sidx) != 1 {
+		t.Errorf("trailing segment boxes not kept: %+v", last)
+	}
+}
+
+func TestTrunFirstSampleFlags(t *testing.T) {
+	tests := []struct {
+		name    string
+		trFlags uint32
+		payload []byte // sample_count onwards
+		want    []TrunSample
+	}{
+		{"no per sample fields", 0x000004, []byte{0, 0, 0, 3, 0x02, 0, 0, 0}, []TrunSample{{sample_flags: 0x02000000}}},
+		{"no first sample flags", 0x000000, []byte{0, 0, 0, 3}, nil},
+		{"durations", 0x000104, []byte{0, 0, 0, 2, 0x02, 0, 0, 0, 0, 0, 0, 10, 0, 0, 0, 11},
+			[]TrunSample{{sample_duration: 10, sample_flags: 0x02000000}, {sample_duration: 11}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr := make([]byte, 4)
+			binary.BigEndian.PutUint32(hdr, tt.trFlags)
+			data := mkBox("moof", mkBox("traf", mkBox("trun", hdr, tt.payload)))
+			f, _, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{Strict: true})
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			if got := f.Moof.Traf[0].Trun.rSamples; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("samples = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
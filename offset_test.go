@@ -0,0 +1,101 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoxOffsets(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	parsers := []struct {
+		name  string
+		parse func() (*File_s, error)
+	}{
+		{"Parse", func() (*File_s, error) { return Parse(bytes.NewReader(data)) }},
+		{"ParseReaderAt", func() (*File_s, error) { return ParseReaderAt(bytes.NewReader(data), int64(len(data))) }},
+	}
+	for _, p := range parsers {
+		t.Run(p.name, func(t *testing.T) {
+			f, err := p.parse()
+			if err != nil {
+				t.Fatalf("parse error: %v", err)
+			}
+			// every box must point back at its own header
+			count := 0
+			Walk(f, func(path []Box, b Box) error {
+				if b == Box(f) {
+					return nil
+				}
+				count++
+				off := b.Offset()
+				if off < 0 || off+8 > int64(len(data)) {
+					t.Fatalf("%s: offset %d outside the file", b.Type(), off)
+				}
+				if got := string(data[off+4 : off+8]); got != b.Type() {
+					t.Errorf("%s at %d: header there is %q", b.Type(), off, got)
+				}
+				if got := int64(binary.BigEndian.Uint32(data[off : off+4])); got != b.Size() {
+					t.Errorf("%s at %d: header size %d, box size %d", b.Type(), off, got, b.Size())
+				}
+				if b.HeaderSize() != 8 {
+					t.Errorf("%s at %d: HeaderSize = %d, want 8", b.Type(), off, b.HeaderSize())
+				}
+				return nil
+			})
+			if count < 50 {
+				t.Errorf("only %d boxes checked", count)
+			}
+			var traks []int64
+			for _, b := range f.Find("moov/trak") {
+				traks = append(traks, b.Offset())
+			}
+			if want := []int64{173, 601, 1055, 4166}; len(traks) != 4 || traks[0] != want[0] || traks[3] != want[3] {
+				t.Errorf("trak offsets = %v, want %v", traks, want)
+			}
+			if mdhd := f.FindFirst("moov/trak[hdlr=soun]/mdia/mdhd"); mdhd == nil || mdhd.Offset() != 4294 {
+				t.Errorf("soun mdhd not found at 4294")
+			}
+		})
+	}
+
+	t.Run("largesize header", func(t *testing.T) {
+		// a moov with a 64 bit size, then a free box
+		moov := mkBox("moov", mkBox("mvhd", make([]byte, 100)), mkBox("udta", mkBox("cprt", make([]byte, 6))))
+		large := make([]byte, 16, 16+len(moov)-8)
+		binary.BigEndian.PutUint32(large[0:4], 1)
+		copy(large[4:8], "moov")
+		binary.BigEndian.PutUint64(large[8:16], uint64(len(moov)+8))
+		large = append(large, moov[8:]...)
+		file := append(large, mkBox("free")...)
+
+		f, err := Parse(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("Parse error: %v", err)
+		}
+		if f.Moov.Offset() != 0 || f.Moov.HeaderSize() != 16 {
+			t.Errorf("moov at %d with %d byte header, want 0 and 16", f.Moov.Offset(), f.Moov.HeaderSize())
+		}
+		if mvhd := f.FindFirst("moov/mvhd"); mvhd == nil || mvhd.Offset() != 16 {
+			t.Errorf("mvhd not found at 16")
+		}
+		if cprt := f.FindFirst("moov/udta/cprt"); cprt == nil || cprt.Offset() != 16+108+8 {
+			t.Errorf("cprt not found at %d", 16+108+8)
+		}
+		if free := f.FindFirst("free"); free == nil || free.Offset() != int64(len(large)) {
+			t.Errorf("free not found at %d", len(large))
+		}
+	})
+
+	t.Run("built in memory", func(t *testing.T) {
+		b := &box{boxtype: "free", size: 8}
+		if b.Offset() != -1 || b.HeaderSize() != 8 {
+			t.Errorf("Offset() = %d HeaderSize() = %d, want -1 and 8", b.Offset(), b.HeaderSize())
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package bmff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParseOptions controls how a parse treats problems in the file
+type ParseOptions struct {
+	// Strict stops at the first malformed or unknown box.  When false the problem is
+	// recorded as a Diagnostic, the box is kept as far as it could be decoded and
+	// parsing carries on with the next box.
+	// Unknown children of stbl, stsd, the sample entries (avc1, mp4a...) and dref are
+	// exempt: those containers routinely hold optional boxes this package does not
+	// decode, such as sample groups, pasp, btrt or alis entries.  Such children are kept
+	// undecoded in either mode and are never reported.
+	Strict bool
+
+	// Limits for untrusted input.  Zero means no limit.  Going past a limit stops the
+	// parse with ErrLimitExceeded in lenient mode too.
+	MaxBoxSize         int64 // largest box, header included, whose payload is read into memory
+	MaxDepth           int   // deepest box nesting.. top level boxes are at depth 1
+	MaxSamplesPerRun   int   // most samples in one track run or sample table
+	MaxTotalAllocation int64 // most bytes of payloads and sample records held for the whole parse
+}
+
+// Diagnostic is one problem a lenient parse stepped over
+type Diagnostic struct {
+	Offset  int64  // offset from the start of the stream of the box concerned
+	Path    string // box types from the top of the file down to BoxType
+	BoxType string // empty if the box header could not be read
+	Err     error  // test with errors.Is, e.g. errors.Is(d.Err, ErrUnknownBox)
+}
+
+func (d Diagnostic) String() string {
+	return (&ParseError{Offset: d.Offset, Path: d.Path, BoxType: d.BoxType, Reason: d.Err}).Error()
+}
+
+// parseState is shared by every box found during one parse
+type parseState struct {
+	ctx       context.Context // nil when the parse cannot be cancelled
+	opts      ParseOptions
+	path      []string // types of the containers being decoded, outermost first
+	diags     []Diagnostic
+	allocated int64 // bytes counted against MaxTotalAllocation
+}
+
+func newParseState(opts ParseOptions) *parseState {
+	return &parseState{opts: opts}
+}
+
+// state returns the parse state of b.  A box decoded outside of a parse gets a lenient one.
+func (b *box) state() *parseState {
+	if b.ps == nil {
+		b.ps = newParseState(ParseOptions{})
+	}
+	return b.ps
+}
+
+// push and pop track the container being decoded so problems can be given a full path.
+// push fails when the children of the container would be deeper than MaxDepth.
+func (ps *parseState) push(b *box) error {
+	if max := ps.opts.MaxDepth; max > 0 && len(ps.path)+2 > max {
+		return ps.locate(fmt.Errorf("%w: children at depth %d, MaxDepth is %d", ErrLimitExceeded, len(ps.path)+2, max), b)
+	}
+	ps.path = append(ps.path, b.boxtype)
+	return nil
+}
+
+func (ps *parseState) pop() {
+	ps.path = ps.path[:len(ps.path)-1]
+}
+
+// locate turns err found at box b into a ParseError carrying the full path of b.
+// b may only be nil when err already is a ParseError (a header that could not be read).
+func (ps *parseState) locate(err error, b *box) *ParseError {
+	var pe *ParseError
+	if !errors.As(err, &pe) {
+		pe = &ParseError{Offset: b.offset, BoxType: b.boxtype, Reason: err}
+	}
+	if pe.Path == "" {
+		parts := append([]string{}, ps.path...)
+		if pe.BoxType != "" {
+			parts = append(parts, pe.BoxType)
+		}
+		pe.Path = strings.Join(parts, "/")
+	}
+	return pe
+}
+
+// problem deals with err found at box b.  Strict parses get it back as a ParseError
+// to return; lenient ones record it and get nil so they carry on.
+func (ps *parseState) problem(err error, b *box) error {
+	if ctxErr := ps.cancelled(); ctxErr != nil {
+		// whatever went wrong, the parse is over
+		return ctxErr
+	}
+	pe := ps.locate(err, b)
+	if ps.opts.Strict || errors.Is(err, ErrLimitExceeded) {
+		return pe
+	}
+	ps.diags = append(ps.diags, Diagnostic{Offset: pe.Offset, Path: pe.Path, BoxType: pe.BoxType, Err: pe.Reason})
+	return nil
+}
+
+// loops over sample records check for cancellation once every this many records
+const cancelCheckInterval = 4096
+
+// tick is called with the index of each record a loop decodes.  It returns the
+// context's error once the parse has been cancelled, checking every cancelCheckInterval records.
+func (ps *parseState) tick(i int) error {
+	if i%cancelCheckInterval != 0 {
+		return nil
+	}
+	return ps.cancelled()
+}
+
+// cancelled returns the context's error once the parse has been cancelled
+func (ps *parseState) cancelled() error {
+	if ps == nil || ps.ctx == nil {
+		return nil
+	}
+	return ps.ctx.Err()
+}
+
+// unknownBox is the problem reported for a box without a registered decoder
+func unknownBox(parent string, b *box) error {
+	if u, ok := b.ExtendedType(); ok {
+		return fmt.Errorf("%w: uuid %s inside %s", ErrUnknownBox, u, parent)
+	}
+	return fmt.Errorf("%w: %q inside %s", ErrUnknownBox, b.boxtype, parent)
+}
+
+// payloadLimit returns the most payload bytes a box with a header of hdrSize bytes may
+// read into memory, -1 for no limit.  ps may be nil.
+func (ps *parseState) payloadLimit(hdrSize int) int64 {
+	if ps == nil {
+		return -1
+	}
+	limit, limited := int64(0), false
+	if max := ps.opts.MaxBoxSize; max > 0 {
+		limit, limited = max-int64(hdrSize), true
+	}
+	if max := ps.opts.MaxTotalAllocation; max > 0 && (!limited || max-ps.allocated < limit) {
+		limit, limited = max-ps.allocated, true
+	}
+	switch {
+	case !limited:
+		return -1
+	case limit < 0:
+		return 0
+	}
+	return limit
+}
+
+// admit checks that the n byte payload of b may be read into memory and counts it.
+// The error is a ParseError for offset 0 of b.  ps may be nil.
+func (ps *parseState) admit(b *box, n int64) error {
+	if ps == nil {
+		return nil
+	}
+	if max := ps.opts.MaxBoxSize; max > 0 && int64(b.hdrSize)+n > max {
+		return &ParseError{BoxType: b.boxtype,
+			Reason: fmt.Errorf("%w: %d byte box, MaxBoxSize is %d", ErrLimitExceeded, int64(b.hdrSize)+n, max)}
+	}
+	if err := ps.allocate(n); err != nil {
+		return &ParseError{BoxType: b.boxtype, Reason: err}
+	}
+	return nil
+}
+
+// allocate counts n bytes against MaxTotalAllocation
+func (ps *parseState) allocate(n int64) error {
+	ps.allocated += n
+	if max := ps.opts.MaxTotalAllocation; max > 0 && ps.allocated > max {
+		return fmt.Errorf("%w: %d bytes allocated, MaxTotalAllocation is %d", ErrLimitExceeded, ps.allocated, max)
+	}
+	return nil
+}
+
+// allocateSamples checks a run or table of count sample records of recSize bytes
+// against MaxSamplesPerRun and counts its memory
+func (ps *parseState) allocateSamples(count uint64, recSize int) error {
+	if max := ps.opts.MaxSamplesPerRun; max > 0 && count > uint64(max) {
+		return fmt.Errorf("%w: %d samples, MaxSamplesPerRun is %d", ErrLimitExceeded, count, max)
+	}
+	return ps.allocate(int64(count) * int64(recSize))
+}
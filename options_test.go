@@ -0,0 +1,139 @@
+package bmff
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	// moov/trak holds an unknown box followed by an mdia whose size overruns the trak
+	badMdia := []byte{0, 0, 0, 100, 'm', 'd', 'i', 'a', 0, 0}
+	var data []byte
+	data = append(data, mkBox("ftyp", []byte("isom"), make([]byte, 4))...)
+	data = append(data, mkBox("moov", mkBox("trak", mkBox("zzzz"), badMdia))...)
+	data = append(data, mkBox("free", make([]byte, 4))...)
+
+	t.Run("lenient", func(t *testing.T) {
+		f, diags, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{})
+		if err != nil {
+			t.Fatalf("ParseWithOptions error: %v", err)
+		}
+		want := []struct {
+			path   string
+			offset int64
+			reason error
+		}{
+			{"moov/trak/zzzz", 32, ErrUnknownBox},
+			{"moov/trak/mdia", 40, ErrTruncated},
+		}
+		if len(diags) != len(want) {
+			t.Fatalf("got %d diagnostics %v, want %d", len(diags), diags, len(want))
+		}
+		for i, w := range want {
+			d := diags[i]
+			if d.Path != w.path || d.Offset != w.offset || !errors.Is(d.Err, w.reason) {
+				t.Errorf("diagnostic %d = %v, want %s at %d: %v", i, d, w.path, w.offset, w.reason)
+			}
+		}
+		// everything around the problems is still there
+		if f.Ftyp == nil || f.Moov == nil || len(f.Moov.TrackBoxes) != 1 || f.GetSubBoxCount() != 3 {
+			t.Errorf("lenient parse lost boxes: ftyp %v moov %v boxes %d", f.Ftyp != nil, f.Moov != nil, f.GetSubBoxCount())
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		f, diags, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{Strict: true})
+		if !errors.Is(err, ErrUnknownBox) {
+			t.Fatalf("error = %v, want %v", err, ErrUnknownBox)
+		}
+		var pe *ParseError
+		if !errors.As(err, &pe) || pe.Path != "moov/trak/zzzz" || pe.Offset != 32 {
+			t.Errorf("error = %v, want moov/trak/zzzz at offset 32", err)
+		}
+		if len(diags) != 0 {
+			t.Errorf("strict parse collected diagnostics: %v", diags)
+		}
+		if f == nil || f.Ftyp == nil {
+			t.Errorf("strict parse did not return the boxes read before the failure")
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		count := 0
+		p := NewStreamParserWithOptions(func(Box) error { count++; return nil }, ParseOptions{})
+		if _, err := p.Write(data); err != nil {
+			t.Fatalf("Write error: %v", err)
+		}
+		if err := p.Close(); err != nil {
+			t.Fatalf("Close error: %v", err)
+		}
+		if count != 3 || len(p.Diagnostics()) != 2 {
+			t.Errorf("got %d boxes and %d diagnostics, want 3 and 2", count, len(p.Diagnostics()))
+		}
+	})
+
+	t.Run("clean file", func(t *testing.T) {
+		fh, err := os.Open(filepath.Join("testdata", "01_simple.mp4"))
+		if err != nil {
+			t.Fatalf("failed to open test file: %v", err)
+		}
+		defer fh.Close()
+		if _, diags, err := ParseWithOptions(fh, ParseOptions{Strict: true}); err != nil || len(diags) != 0 {
+			t.Errorf("strict parse of a clean file: %d diagnostics, error %v", len(diags), err)
+		}
+	})
+}
+
+func TestParseLimits(t *testing.T) {
+	simple, err := os.ReadFile(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	// a box claiming 4GB backed by a few bytes
+	forged := append(mkBox("ftyp", []byte("isom"), make([]byte, 4)), 0xff, 0xff, 0xff, 0xf0, 'm', 'o', 'o', 'v', 0, 0, 0, 0)
+	// 20 bytes of stsz giving one size to 4 billion samples
+	constStsz := mkBox("stsz", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff})
+
+	tests := []struct {
+		name       string
+		data       []byte
+		opts       ParseOptions
+		wantOffset int64
+		wantPath   string
+	}{
+		{"box too large", simple, ParseOptions{MaxBoxSize: 10000}, 5724, "mdat"},
+		{"forged size", forged, ParseOptions{MaxBoxSize: 1 << 20}, 16, "moov"},
+		{"too deep", simple, ParseOptions{MaxDepth: 3}, 273, "moov/trak/mdia"},
+		{"too deep strict", simple, ParseOptions{MaxDepth: 3, Strict: true}, 273, "moov/trak/mdia"},
+		{"too many samples", mkFragmentedFile(1, 1000), ParseOptions{MaxSamplesPerRun: 100}, 200, "moof/traf/trun"},
+		{"too many constant-size samples", mkStbl(constStsz), ParseOptions{MaxSamplesPerRun: 100}, 40, "moov/trak/mdia/minf/stbl/stsz"},
+		{"too much memory", simple, ParseOptions{MaxTotalAllocation: 100000}, 5724, "mdat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseWithOptions(bytes.NewReader(tt.data), tt.opts)
+			if !errors.Is(err, ErrLimitExceeded) {
+				t.Fatalf("error = %v, want %v", err, ErrLimitExceeded)
+			}
+			var pe *ParseError
+			if !errors.As(err, &pe) || pe.Offset != tt.wantOffset || pe.Path != tt.wantPath {
+				t.Errorf("error = %v, want %s at offset %d", err, tt.wantPath, tt.wantOffset)
+			}
+		})
+	}
+
+	// the stream parser refuses an oversized box as soon as its header arrives
+	p := NewStreamParserWithOptions(func(Box) error { return nil }, ParseOptions{MaxBoxSize: 10000})
+	if _, err := p.Write(simple[:5740]); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("StreamParser error = %v, want %v", err, ErrLimitExceeded)
+	}
+
+	// within the limits the whole file parses
+	opts := ParseOptions{MaxBoxSize: 1 << 20, MaxDepth: 10, MaxSamplesPerRun: 1000, MaxTotalAllocation: 1 << 20}
+	if _, _, err := ParseWithOptions(bytes.NewReader(simple), opts); err != nil {
+		t.Errorf("ParseWithOptions within limits: %v", err)
+	}
+}
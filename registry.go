@@ -0,0 +1,203 @@
+package bmff
+
+import (
+	"fmt"
+	"sync"
+)
+
+// RawBox is the undecoded box handed to a registered factory.  A decoder for a new
+// box type embeds *RawBox in its own struct, which makes it a Box, and decodes
+// the payload available from Raw().  A full box starts with its version and flags;
+// FullBoxHeader reads them and the decoder's own fields follow at Raw()[4:].
+type RawBox = box
+
+// BoxFactory decodes a raw box into its specific type.  Returning a nil Box keeps
+// the raw box in the tree, marked as not decoded.
+type BoxFactory func(*box) (Box, error)
+
+// TopLevel is the parent name used to register boxes found at the top level of a file
+const TopLevel = "file"
+
+type boxDecoder struct {
+	parents []string // empty means any parent
+	factory BoxFactory
+}
+
+var (
+	registryLock sync.RWMutex
+	boxRegistry  = map[string][]boxDecoder{} // keyed by fourcc
+	uuidRegistry = map[UUID][]boxDecoder{}
+)
+
+// RegisterBox makes factory the decoder for boxes of type fourcc found inside any of
+// the given parent box types (TopLevel for the top of the file).  nil parents matches
+// every parent.  A later registration overrides an earlier one, including the ones
+// built into this package.
+func RegisterBox(fourcc string, parents []string, factory func(*box) (Box, error)) {
+	if len(fourcc) != 4 {
+		panic(fmt.Sprintf("bmff: RegisterBox: box type %q is not 4 characters", fourcc))
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	boxRegistry[fourcc] = append(boxRegistry[fourcc], boxDecoder{parents: parents, factory: factory})
+}
+
+// RegisterUUID makes factory the decoder for 'uuid' boxes with the given extended type.
+// usertype is written in the canonical hex form, e.g. "a2394f52-5a9b-4f14-a244-6c427c648df4"
+// (the dashes are optional).
+func RegisterUUID(usertype string, parents []string, factory func(*box) (Box, error)) {
+	u, err := ParseUUID(usertype)
+	if err != nil {
+		panic(fmt.Sprintf("bmff: RegisterUUID: bad extended type %q", usertype))
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	uuidRegistry[u] = append(uuidRegistry[u], boxDecoder{parents: parents, factory: factory})
+}
+
+// unregisterBox drops the most recent registration for fourcc, restoring whatever
+// decoder it overrode.  Used by tests to keep the package registry unchanged.
+func unregisterBox(fourcc string) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if n := len(boxRegistry[fourcc]); n > 1 {
+		boxRegistry[fourcc] = boxRegistry[fourcc][:n-1]
+	} else {
+		delete(boxRegistry, fourcc)
+	}
+}
+
+// unregisterUUID is unregisterBox for 'uuid' boxes
+func unregisterUUID(u UUID) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if n := len(uuidRegistry[u]); n > 1 {
+		uuidRegistry[u] = uuidRegistry[u][:n-1]
+	} else {
+		delete(uuidRegistry, u)
+	}
+}
+
+// lookupDecoder finds the most recently registered factory for b inside parent
+func lookupDecoder(parent string, b *box) BoxFactory {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	decoders := boxRegistry[b.boxtype]
+	if u, ok := b.ExtendedType(); ok {
+		decoders = uuidRegistry[u]
+	}
+	for i := len(decoders) - 1; i >= 0; i-- {
+		d := decoders[i]
+		if len(d.parents) == 0 {
+			return d.factory
+		}
+		for _, p := range d.parents {
+			if p == parent {
+				return d.factory
+			}
+		}
+	}
+	return nil
+}
+
+// decodeBox runs the registered decoder for b found inside parent.
+// unknown types come back as the raw box flagged as not decoded, with an ErrUnknownBox error.
+// The returned Box is never nil, even when decoding failed.
+func decodeBox(parent string, b *box) (Box, error) {
+	factory := lookupDecoder(parent, b)
+	if factory == nil {
+		b.typeNotDecoded = true
+		return b, unknownBox(parent, b)
+	}
+	bx, err := factory(b)
+	if bx == nil {
+		b.typeNotDecoded = true
+		bx = b
+	}
+	return bx, err
+}
+
+// parser is implemented by every box type decoded by this package
+type parser interface {
+	Box
+	parse() error
+}
+
+// keepRaw is a parseChildren fallback for containers where types without a decoder
+// are expected: such children stay in the tree, undecoded, without a diagnostic.
+// The containers using it are listed in the ParseOptions.Strict doc comment.
+func keepRaw(*box) (Box, error) {
+	return nil, nil
+}
+
+// parsedBy adapts a constructor for one of our box types into a BoxFactory
+func parsedBy(newBox func(*box) parser) BoxFactory {
+	return func(b *box) (Box, error) {
+		bx := newBox(b)
+		return bx, bx.parse()
+	}
+}
+
+// ParseChildren decodes the boxes in payload as the children of b, using the registry
+// with b's type as their parent, and appends them to b.  It is meant for decoders of
+// container types registered with RegisterBox.  payload is the end of Raw() after any
+// fields the container holds ahead of its children, and found, when not nil, is handed
+// each child as it is decoded.  Problems with a child are handled as for every other
+// box of the parse.
+func (b *box) ParseChildren(payload []byte, found func(Box)) error {
+	return b.parseChildren(payload, nil, found)
+}
+
+// parseChildren decodes the boxes packed in payload (normally the container's raw
+// data) using the registry, appends each one to the container and hands it to found
+// so the container can keep typed references.  Children without a registered
+// decoder are built with fallback when it is not nil.
+// Problems with a child are handled by the parse state: a strict parse returns the
+// first one, a lenient parse records it, keeps the child and moves on.
+func (b *box) parseChildren(payload []byte, fallback BoxFactory, found func(Box)) error {
+	ps := b.state()
+	if err := ps.push(b); err != nil {
+		return err
+	}
+	defer ps.pop()
+	b.childOff = len(b.raw) - len(payload)
+	base := b.offset + int64(b.hdrSize) + int64(b.childOff)
+	children := newBoxIter(payload, base, b.Tag)
+	for subBox := children.Next(); subBox != nil; subBox = children.Next() {
+		if err := ps.cancelled(); err != nil {
+			return err
+		}
+		subBox.ps = ps
+		if subBox.size == 0 {
+			// size=0 is only legal for the last top level box.. it simply runs to the end of the container here
+			if err := ps.problem(fmt.Errorf("%w: size=0 inside a container", ErrBadSize), subBox); err != nil {
+				return err
+			}
+		}
+		var bx Box
+		var err error
+		if fallback != nil && lookupDecoder(b.boxtype, subBox) == nil {
+			if bx, err = fallback(subBox); bx == nil {
+				subBox.typeNotDecoded = true
+				bx = subBox
+			}
+		} else {
+			bx, err = decodeBox(b.boxtype, subBox)
+		}
+		if err != nil {
+			if err = ps.problem(err, subBox); err != nil {
+				return err
+			}
+		}
+		if found != nil {
+			found(bx)
+		}
+		b.AddSubBox(bx)
+	}
+	if err := children.Err(); err != nil {
+		// nothing after a broken header can be trusted.. keep it for Output
+		b.tail = children.Rest()
+		return ps.problem(err, nil)
+	}
+	return nil
+}
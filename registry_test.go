@@ -0,0 +1,113 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// vendorBox is decoded the way code outside the package would do it
+type vendorBox struct {
+	*RawBox
+	Value uint32
+}
+
+// vendorFullBox is a vendor box with a FullBox header
+type vendorFullBox struct {
+	*RawBox
+	Version uint8
+	Flags   uint32
+	Value   uint32
+}
+
+// vendorContainer is a vendor full box holding other boxes
+type vendorContainer struct {
+	*RawBox
+	Tests []*vendorBox
+}
+
+func TestRegisterBox(t *testing.T) {
+	RegisterBox("xtst", []string{"moov", "traf", "xcon"}, func(b *RawBox) (Box, error) {
+		vb := &vendorBox{RawBox: b}
+		vb.Value = binary.BigEndian.Uint32(b.Raw())
+		return vb, nil
+	})
+	t.Cleanup(func() { unregisterBox("xtst") })
+	RegisterBox("xful", []string{"moov"}, func(b *RawBox) (Box, error) {
+		vb := &vendorFullBox{RawBox: b}
+		var err error
+		if vb.Version, vb.Flags, err = b.FullBoxHeader(); err != nil {
+			return vb, err
+		}
+		vb.Value = binary.BigEndian.Uint32(b.Raw()[4:])
+		return vb, nil
+	})
+	t.Cleanup(func() { unregisterBox("xful") })
+	RegisterBox("xcon", []string{"moov"}, func(b *RawBox) (Box, error) {
+		vc := &vendorContainer{RawBox: b}
+		if _, _, err := b.FullBoxHeader(); err != nil {
+			return vc, err
+		}
+		return vc, b.ParseChildren(b.Raw()[4:], func(child Box) {
+			if vb, ok := child.(*vendorBox); ok {
+				vc.Tests = append(vc.Tests, vb)
+			}
+		})
+	})
+	t.Cleanup(func() { unregisterBox("xcon") })
+	usertype := "0f1e2d3c-4b5a-6978-8796-a5b4c3d2e1f0"
+	RegisterUUID(usertype, nil, func(b *RawBox) (Box, error) {
+		return &vendorBox{RawBox: b, Value: uint32(len(b.Raw()))}, nil
+	})
+	t.Cleanup(func() { unregisterUUID(MustParseUUID(usertype)) })
+	uuidBox := mkBox("uuid", []byte{0x0f, 0x1e, 0x2d, 0x3c, 0x4b, 0x5a, 0x69, 0x78, 0x87, 0x96, 0xa5, 0xb4, 0xc3, 0xd2, 0xe1, 0xf0}, []byte{1, 2, 3})
+	binary.BigEndian.PutUint32(uuidBox[0:4], uint32(len(uuidBox)))
+
+	data := mkBox("moov", mkBox("xtst", []byte{0, 0, 0, 42}), uuidBox, mkBox("xful", []byte{1, 0x12, 0x34, 0x56, 0, 0, 0, 9}),
+		mkBox("xcon", make([]byte, 4), mkBox("xtst", []byte{0, 0, 0, 5}), mkBox("xtst", []byte{0, 0, 0, 6})))
+	data = append(data, mkBox("xtst", []byte{0, 0, 0, 7})...) // not registered at the top level
+
+	f, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if f.Moov == nil || f.Moov.GetSubBoxCount() != 4 {
+		t.Fatalf("moov children not parsed")
+	}
+	if vb, ok := f.Moov.subBox[0].(*vendorBox); !ok || vb.Value != 42 {
+		t.Errorf("registered box decoded as %T %+v", f.Moov.subBox[0], f.Moov.subBox[0])
+	}
+	if vb, ok := f.Moov.subBox[1].(*vendorBox); !ok || vb.Value != 3 {
+		t.Errorf("registered uuid box decoded as %T", f.Moov.subBox[1])
+	}
+	if vb, ok := f.Moov.subBox[2].(*vendorFullBox); !ok || vb.Version != 1 || vb.Flags != 0x123456 || vb.Value != 9 {
+		t.Errorf("registered full box decoded as %T %+v", f.Moov.subBox[2], f.Moov.subBox[2])
+	}
+	if vc, ok := f.Moov.subBox[3].(*vendorContainer); !ok || len(vc.Tests) != 2 || vc.Tests[1].Value != 6 ||
+		vc.GetSubBoxCount() != 2 || vc.Children()[0].Offset() != vc.Offset()+12 {
+		t.Errorf("registered container decoded as %T %+v", f.Moov.subBox[3], f.Moov.subBox[3])
+	}
+	if top, ok := f.subBox[1].(*box); !ok || !bool(top.typeNotDecoded) {
+		t.Errorf("box registered for moov was decoded at the top level as %T", f.subBox[1])
+	}
+
+	// the decoded boxes still write back out unchanged
+	var out bytes.Buffer
+	if _, err := f.Output(&out, 6); err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("Output() mismatch, err = %v", err)
+	}
+}
+
+func TestUnregisterBox(t *testing.T) {
+	RegisterBox("free", nil, func(b *RawBox) (Box, error) {
+		return &vendorBox{RawBox: b}, nil
+	})
+	unregisterBox("free")
+	f, err := Parse(bytes.NewReader(mkBox("free", []byte{1, 2})))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if _, ok := f.subBox[0].(*FreeBox); !ok {
+		t.Errorf("free decoded as %T after unregistering the override", f.subBox[0])
+	}
+}
@@ -0,0 +1,218 @@
+package bmff
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+// SampleTable locates the samples of a track in the file from its stsc, stsz or stz2 and
+// stco or co64.  Samples and chunks are numbered from 0 here, though the boxes number
+// them from 1.
+type SampleTable struct {
+	count      int
+	sampleSize uint32   // of every sample.. 0 when sizes gives them
+	sizes      []uint32 // from stsz or stz2
+	sizeSum    []uint64 // sizeSum[n] is the bytes of the samples before n, nil with sampleSize
+	offsets32  []uint32 // chunk offsets from stco
+	offsets64  []uint64 // or from co64
+	runs       []chunkRun
+}
+
+// chunkRun is one stsc entry with the chunk count and sample number it starts at
+type chunkRun struct {
+	firstChunk  int
+	chunks      int
+	perChunk    int
+	firstSample int
+	description uint32
+}
+
+// SampleLocation says where a sample is stored
+type SampleLocation struct {
+	Chunk            int   // numbered from 0
+	Offset           int64 // of the first byte of the sample, from the start of the file
+	Size             uint32
+	DescriptionIndex uint32 // of the stsd entry describing the sample, numbered from 1
+}
+
+// NewSampleTable builds the sample table of stbl.  It checks that stsc accounts for
+// exactly the samples of stsz and for no chunk that stco does not have.
+func NewSampleTable(stbl *StblBox) (*SampleTable, error) {
+	t := &SampleTable{}
+	switch {
+	case stbl.Stsz != nil:
+		t.count = int(stbl.Stsz.SampleCount)
+		t.sampleSize = stbl.Stsz.SampleSize
+		t.sizes = stbl.Stsz.Sizes
+	case stbl.Stz2 != nil:
+		t.count = len(stbl.Stz2.Sizes)
+		t.sizes = stbl.Stz2.Sizes
+	default:
+		return nil, fmt.Errorf("%w: stsz", ErrMissingBox)
+	}
+	switch {
+	case stbl.Stco != nil:
+		t.offsets32 = stbl.Stco.ChunkOffsets
+	case stbl.Co64 != nil:
+		t.offsets64 = stbl.Co64.ChunkOffsets
+	default:
+		return nil, fmt.Errorf("%w: stco", ErrMissingBox)
+	}
+	if stbl.Stsc == nil {
+		return nil, fmt.Errorf("%w: stsc", ErrMissingBox)
+	}
+
+	chunks := t.ChunkCount()
+	var total uint64
+	entries := stbl.Stsc.Entries
+	t.runs = make([]chunkRun, 0, len(entries))
+	for i, e := range entries {
+		first := int64(e.FirstChunk) - 1
+		if (i == 0 && first != 0) || (i > 0 && first <= int64(t.runs[i-1].firstChunk)) {
+			return nil, fmt.Errorf("%w: stsc entry %d starts at chunk %d", ErrBadValue, i+1, e.FirstChunk)
+		}
+		if first > int64(chunks) {
+			return nil, fmt.Errorf("%w: stsc entry %d starts at chunk %d of %d", ErrBadValue, i+1, e.FirstChunk, chunks)
+		}
+		end := int64(chunks)
+		if i+1 < len(entries) && int64(entries[i+1].FirstChunk)-1 < end {
+			end = int64(entries[i+1].FirstChunk) - 1
+		}
+		if end < first {
+			end = first
+		}
+		t.runs = append(t.runs, chunkRun{firstChunk: int(first), chunks: int(end - first), perChunk: int(e.SamplesPerChunk),
+			firstSample: int(total), description: e.SampleDescriptionIndex})
+		total += uint64(end-first) * uint64(e.SamplesPerChunk)
+		if total > uint64(t.count) {
+			break
+		}
+	}
+	if total != uint64(t.count) {
+		return nil, fmt.Errorf("%w: stsc holds %d samples, the sample sizes give %d", ErrBadValue, total, t.count)
+	}
+
+	// offsets are int64.. the samples together must not run past that
+	if hi, lo := bits.Mul64(uint64(t.count), uint64(t.sampleSize)); hi != 0 || lo > math.MaxInt64 {
+		return nil, fmt.Errorf("%w: %d samples of %d bytes", ErrBadValue, t.count, t.sampleSize)
+	}
+	if t.sampleSize == 0 {
+		t.sizeSum = make([]uint64, t.count+1)
+		for n, size := range t.sizes {
+			t.sizeSum[n+1] = t.sizeSum[n] + uint64(size)
+		}
+	}
+	return t, nil
+}
+
+// SampleCount returns the number of samples in the table
+func (t *SampleTable) SampleCount() int {
+	return t.count
+}
+
+// ChunkCount returns the number of chunks in the table
+func (t *SampleTable) ChunkCount() int {
+	if t.offsets64 != nil {
+		return len(t.offsets64)
+	}
+	return len(t.offsets32)
+}
+
+func (t *SampleTable) chunkOffset(chunk int) int64 {
+	if t.offsets64 != nil {
+		return int64(t.offsets64[chunk])
+	}
+	return int64(t.offsets32[chunk])
+}
+
+// bytesBefore returns the bytes of the samples before sample n
+func (t *SampleTable) bytesBefore(n int) int64 {
+	if t.sizeSum == nil {
+		return int64(n) * int64(t.sampleSize)
+	}
+	return int64(t.sizeSum[n])
+}
+
+// Locate returns the chunk, offset and size of sample n
+func (t *SampleTable) Locate(n int) (SampleLocation, error) {
+	if n < 0 || n >= t.count {
+		return SampleLocation{}, fmt.Errorf("%w: sample %d of %d", ErrBadValue, n, t.count)
+	}
+	i := sort.Search(len(t.runs), func(i int) bool {
+		r := &t.runs[i]
+		return r.firstSample+r.chunks*r.perChunk > n
+	})
+	r := &t.runs[i]
+	k, rem := (n-r.firstSample)/r.perChunk, (n-r.firstSample)%r.perChunk
+	loc := SampleLocation{Chunk: r.firstChunk + k, Size: t.sampleSize, DescriptionIndex: r.description}
+	loc.Offset = t.chunkOffset(loc.Chunk) + t.bytesBefore(n) - t.bytesBefore(n-rem)
+	if t.sizeSum != nil {
+		loc.Size = t.sizes[n]
+	}
+	return loc, nil
+}
+
+// Validate checks that every chunk lies inside the payload of one of mdats
+func (t *SampleTable) Validate(mdats []*MdatBox) error {
+	return t.validate(mdats, nil)
+}
+
+// validate checks the chunks of the sample descriptions inFile accepts, all of them
+// when it is nil
+func (t *SampleTable) validate(mdats []*MdatBox, inFile func(description uint32) bool) error {
+	type span struct{ start, end int64 }
+	payloads := make([]span, 0, len(mdats))
+	for _, m := range mdats {
+		payloads = append(payloads, span{m.Offset() + int64(m.HeaderSize()), m.Offset() + m.Size()})
+	}
+	sort.Slice(payloads, func(i, j int) bool { return payloads[i].start < payloads[j].start })
+
+	for _, r := range t.runs {
+		if r.perChunk == 0 || (inFile != nil && !inFile(r.description)) {
+			continue
+		}
+		if len(mdats) == 0 {
+			return fmt.Errorf("%w: mdat", ErrMissingBox)
+		}
+		for k := 0; k < r.chunks; k++ {
+			first := r.firstSample + k*r.perChunk
+			start := t.chunkOffset(r.firstChunk + k)
+			end := start + t.bytesBefore(first+r.perChunk) - t.bytesBefore(first)
+			i := sort.Search(len(payloads), func(i int) bool { return payloads[i].start > start }) - 1
+			if i < 0 || end > payloads[i].end {
+				return fmt.Errorf("%w: chunk %d at bytes %d..%d is outside every mdat", ErrBadValue, r.firstChunk+k, start, end)
+			}
+		}
+	}
+	return nil
+}
+
+// SampleTable returns the sample table of the track, without checking it against the
+// mdat boxes.. see File_s.SampleTable
+func (b *TrakBox) SampleTable() (*SampleTable, error) {
+	if b.Mdia == nil || b.Mdia.Minf == nil || b.Mdia.Minf.Stbl == nil {
+		return nil, fmt.Errorf("%w: stbl", ErrMissingBox)
+	}
+	return NewSampleTable(b.Mdia.Minf.Stbl)
+}
+
+// SampleTable returns the sample table of trak after checking that every chunk it
+// describes is inside one of the file's mdat boxes
+func (f *File_s) SampleTable(trak *TrakBox) (*SampleTable, error) {
+	t, err := trak.SampleTable()
+	if err != nil {
+		return nil, err
+	}
+	var mdats []*MdatBox
+	for _, child := range f.Children() {
+		if m, ok := child.(*MdatBox); ok {
+			mdats = append(mdats, m)
+		}
+	}
+	if err := t.Validate(mdats); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
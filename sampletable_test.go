@@ -0,0 +1,133 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSampleTable(t *testing.T) {
+	stsc := mkBox("stsc", []byte{0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 3, 0, 0, 0, 1, 0, 0, 0, 2})
+	stco := func(offsets ...uint32) []byte {
+		p := binary.BigEndian.AppendUint32(make([]byte, 4), uint32(len(offsets)))
+		for _, o := range offsets {
+			p = binary.BigEndian.AppendUint32(p, o)
+		}
+		return mkBox("stco", p)
+	}
+	co64 := func(offsets ...uint64) []byte {
+		p := binary.BigEndian.AppendUint32(make([]byte, 4), uint32(len(offsets)))
+		for _, o := range offsets {
+			p = binary.BigEndian.AppendUint64(p, o)
+		}
+		return mkBox("co64", p)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		sample  int
+		want    SampleLocation // Offset from the start of the mdat payload
+		wantErr error
+	}{
+		{"variable sizes", mkProgressive(300, func(base uint32) [][]byte {
+			return [][]byte{stsc, mkStsz(10, 20, 30, 40, 50), stco(base, base+100, base+200)}
+		}), 3, SampleLocation{Chunk: 1, Offset: 130, Size: 40, DescriptionIndex: 1}, nil},
+		{"second stsc entry", mkProgressive(300, func(base uint32) [][]byte {
+			return [][]byte{stsc, mkStsz(10, 20, 30, 40, 50), stco(base, base+100, base+200)}
+		}), 4, SampleLocation{Chunk: 2, Offset: 200, Size: 50, DescriptionIndex: 2}, nil},
+		{"constant size and co64", mkProgressive(300, func(base uint32) [][]byte {
+			return [][]byte{stsc, mkBox("stsz", []byte{0, 0, 0, 0, 0, 0, 0, 25, 0, 0, 0, 5}), co64(uint64(base)+200, uint64(base), uint64(base)+100)}
+		}), 1, SampleLocation{Chunk: 0, Offset: 225, Size: 25, DescriptionIndex: 1}, nil},
+		{"4 bit stz2", mkProgressive(300, func(base uint32) [][]byte {
+			return [][]byte{stsc, mkBox("stz2", []byte{0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 5, 0x12, 0x34, 0x50}), stco(base, base+100, base+200)}
+		}), 1, SampleLocation{Chunk: 0, Offset: 1, Size: 2, DescriptionIndex: 1}, nil},
+		{"stsc short of the samples", mkProgressive(300, func(base uint32) [][]byte {
+			return [][]byte{stsc, mkStsz(10, 20, 30, 40, 50, 60), stco(base, base+100, base+200)}
+		}), 0, SampleLocation{}, ErrBadValue},
+		{"stsc not starting at chunk 1", mkProgressive(300, func(base uint32) [][]byte {
+			return [][]byte{mkBox("stsc", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 1}), mkStsz(10), stco(base, base)}
+		}), 0, SampleLocation{}, ErrBadValue},
+		{"chunk past the mdat", mkProgressive(300, func(base uint32) [][]byte {
+			return [][]byte{stsc, mkStsz(10, 20, 30, 40, 50), stco(base, base+100, base+260)}
+		}), 0, SampleLocation{}, ErrBadValue},
+		{"chunk before the mdat", mkProgressive(300, func(base uint32) [][]byte {
+			return [][]byte{stsc, mkStsz(10, 20, 30, 40, 50), stco(8, base+100, base+200)}
+		}), 0, SampleLocation{}, ErrBadValue},
+		{"constant size past int64", mkProgressive(300, func(base uint32) [][]byte {
+			return [][]byte{mkBox("stsc", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 1}),
+				mkBox("stsz", []byte{0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}), stco(base)}
+		}), 0, SampleLocation{}, ErrBadValue},
+		{"no chunk offsets", mkProgressive(300, func(base uint32) [][]byte {
+			return [][]byte{stsc, mkStsz(10, 20, 30, 40, 50)}
+		}), 0, SampleLocation{}, ErrMissingBox},
+		{"no mdat", mkStbl(stsc, mkStsz(10, 20, 30, 40, 50), stco(0, 100, 200)), 0, SampleLocation{}, ErrMissingBox},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _, err := ParseWithOptions(bytes.NewReader(tt.data), ParseOptions{Strict: true})
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			st, err := f.SampleTable(f.Moov.TrackBoxes[0])
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SampleTable() error = %v", err)
+			}
+			if st.SampleCount() != 5 || st.ChunkCount() != 3 {
+				t.Errorf("%d samples in %d chunks, want 5 in 3", st.SampleCount(), st.ChunkCount())
+			}
+			loc, err := st.Locate(tt.sample)
+			if err != nil {
+				t.Fatalf("Locate(%d) error = %v", tt.sample, err)
+			}
+			loc.Offset -= f.Mdat.Offset() + int64(f.Mdat.HeaderSize())
+			if loc != tt.want {
+				t.Errorf("Locate(%d) = %+v, want %+v", tt.sample, loc, tt.want)
+			}
+			if _, err := st.Locate(5); !errors.Is(err, ErrBadValue) {
+				t.Errorf("Locate(5) error = %v, want %v", err, ErrBadValue)
+			}
+		})
+	}
+}
+
+func TestSampleTableFile(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	f, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	for _, trak := range f.Moov.TrackBoxes {
+		st, err := f.SampleTable(trak)
+		if err != nil {
+			t.Fatalf("track %d: SampleTable() error = %v", trak.Tkhd.TrackID, err)
+		}
+		if n := int(trak.Mdia.Minf.Stbl.Stts.SampleCount()); st.SampleCount() != n {
+			t.Errorf("track %d: %d samples, stts has %d", trak.Tkhd.TrackID, st.SampleCount(), n)
+		}
+		// samples of a chunk follow one another
+		var next int64
+		for n := 0; n < st.SampleCount(); n++ {
+			loc, err := st.Locate(n)
+			if err != nil {
+				t.Fatalf("track %d: Locate(%d) error = %v", trak.Tkhd.TrackID, n, err)
+			}
+			if n > 0 && loc.Offset != next && loc.Offset != int64(trak.Mdia.Minf.Stbl.Stco.ChunkOffsets[loc.Chunk]) {
+				t.Errorf("track %d: sample %d at %d, want %d or its chunk start", trak.Tkhd.TrackID, n, loc.Offset, next)
+			}
+			next = loc.Offset + int64(loc.Size)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package bmff
+
+import (
+	"bytes"
+	"efmt"
+	"encoding/binary"
+	"fmt"
+)
+
+// StreamParser incrementally parses a live byte stream (for example an fMP4 delivered
+// over TCP or HTTP chunked transfer).  Bytes are pushed in with Write in chunks of any
+// size; each top level box is decoded with the same parsers used by Parse and handed
+// to the callback as soon as its last byte arrives.
+//
+// Boxes are not retained by the parser, so memory use is bounded by the largest box.
+type StreamParser struct {
+	onBox  func(Box) error
+	buf    []byte     // bytes of the incomplete box at the head of the stream
+	tag    *efmt.Ntag // tag for the next top level box
+	offset int64      // stream offset of buf[0]
+	err    error      // sticky.. once set all further writes fail
+	ps     *parseState
+}
+
+// NewStreamParser returns a StreamParser that calls onBox for every completed top level box.
+// An error returned by onBox stops the parser and is returned from Write.
+func NewStreamParser(onBox func(Box) error) *StreamParser {
+	return NewStreamParserWithOptions(onBox, ParseOptions{})
+}
+
+// NewStreamParserWithOptions returns a StreamParser handling problems as opts asks.
+// Problems stepped over by a lenient parser are available from Diagnostics.
+// As boxes are not retained, MaxTotalAllocation applies to each top level box.
+func NewStreamParserWithOptions(onBox func(Box) error, opts ParseOptions) *StreamParser {
+	return &StreamParser{
+		onBox: onBox,
+		tag:   efmt.NewNtag(),
+		ps:    newParseState(opts),
+	}
+}
+
+// Diagnostics returns the problems stepped over so far
+func (p *StreamParser) Diagnostics() []Diagnostic {
+	return p.ps.diags
+}
+
+// Write implements io.Writer.  It buffers data and emits every box it completes.
+func (p *StreamParser) Write(data []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	p.buf = append(p.buf, data...)
+	consumed := 0
+	for {
+		total, ok, err := nextBoxSize(p.buf[consumed:], p.offset+int64(consumed), p.ps.opts.MaxBoxSize)
+		if err != nil {
+			p.err = err
+			return len(data), err
+		}
+		if !ok {
+			break
+		}
+		if err := p.emit(p.buf[consumed:consumed+total], p.offset+int64(consumed)); err != nil {
+			p.err = err
+			return len(data), err
+		}
+		consumed += total
+	}
+	// keep only the unfinished box
+	p.offset += int64(consumed)
+	p.buf = append(p.buf[:0], p.buf[consumed:]...)
+	return len(data), nil
+}
+
+// Close ends the stream.  A trailing size=0 box (extends to end of stream) is emitted now;
+// any other partially received box is reported as an error.
+func (p *StreamParser) Close() error {
+	if p.err != nil {
+		return p.err
+	}
+	if len(p.buf) == 0 {
+		return nil
+	}
+	if len(p.buf) >= 8 && binary.BigEndian.Uint32(p.buf[0:4]) == 0 {
+		if err := p.emit(p.buf, p.offset); err != nil {
+			p.err = err
+			return err
+		}
+		p.offset += int64(len(p.buf))
+		p.buf = nil
+		return nil
+	}
+	pe := &ParseError{Offset: p.offset, Reason: fmt.Errorf("%w: stream ended with %d bytes of a box", ErrTruncated, len(p.buf))}
+	if len(p.buf) >= boxHeaderSize {
+		pe.BoxType = string(p.buf[4:8])
+		pe.Path = pe.BoxType
+	}
+	p.err = pe
+	return pe
+}
+
+// nextBoxSize reports the total size of the box at the start of buf (found at offset
+// in the stream), and whether all of it has been received.  Boxes larger than
+// maxSize (when not zero) are refused as soon as their header arrives.
+func nextBoxSize(buf []byte, offset int64, maxSize int64) (total int, complete bool, err error) {
+	if len(buf) < boxHeaderSize {
+		return 0, false, nil
+	}
+	size := int64(binary.BigEndian.Uint32(buf[0:4]))
+	hdrSize := boxHeaderSize
+	if size == 1 {
+		hdrSize += 8
+	}
+	if string(buf[4:8]) == "uuid" {
+		hdrSize += 16
+	}
+	if len(buf) < hdrSize {
+		return 0, false, nil
+	}
+	switch {
+	case size == 0:
+		// runs to the end of the stream.. wait for Close
+		size = int64(len(buf))
+		if maxSize > 0 && size > maxSize {
+			break
+		}
+		return 0, false, nil
+	case size == 1:
+		size = int64(binary.BigEndian.Uint64(buf[8:16]))
+	}
+	if maxSize > 0 && size > maxSize {
+		boxtype := string(buf[4:8])
+		return 0, false, &ParseError{Offset: offset, Path: boxtype, BoxType: boxtype,
+			Reason: fmt.Errorf("%w: %d byte box, MaxBoxSize is %d", ErrLimitExceeded, size, maxSize)}
+	}
+	if size < int64(hdrSize) {
+		boxtype := string(buf[4:8])
+		return 0, false, &ParseError{Offset: offset, Path: boxtype, BoxType: boxtype,
+			Reason: fmt.Errorf("%w: size %d smaller than its %d byte header", ErrBadSize, size, hdrSize)}
+	}
+	if int64(len(buf)) < size {
+		return 0, false, nil
+	}
+	return int(size), true, nil
+}
+
+// emit decodes one complete top level box found at offset and hands it to the callback
+func (p *StreamParser) emit(data []byte, offset int64) error {
+	// boxes are not kept, so the allocation limit applies to each one on its own
+	p.ps.allocated = 0
+	b, err := readBox(bytes.NewReader(data), p.tag, p.ps)
+	p.tag.Next()
+	if err != nil {
+		return p.ps.locate(rebase(err, offset), nil)
+	}
+	b.offset = offset
+	b.ps = p.ps
+	bx, err := decodeTopBox(b)
+	if err != nil {
+		return err
+	}
+	return p.onBox(bx)
+}
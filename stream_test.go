@@ -0,0 +1,89 @@
+package bmff
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamParser(t *testing.T) {
+	simple, err := os.ReadFile(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	var live []byte
+	live = append(live, mkBox("styp", []byte("msdh"), make([]byte, 4))...)
+	live = append(live, mkFragment(1, 100)...)
+	live = append(live, mkBox("free")...)
+	live = append(live, mkFragment(2, 200)...)
+	live = append(live, []byte{0, 0, 0, 0, 'm', 'd', 'a', 't', 1, 2, 3}...) // size=0.. runs to end of stream
+
+	tests := []struct {
+		name      string
+		data      []byte
+		chunkSize int
+		want      []string
+	}{
+		{"simple file, 1000 byte chunks", simple, 1000, []string{"ftyp", "moov", "mdat", "free"}},
+		{"simple file, one write", simple, len(simple), []string{"ftyp", "moov", "mdat", "free"}},
+		{"live fragments, 1 byte chunks", live, 1, []string{"styp", "moof", "mdat", "free", "moof", "mdat", "mdat"}},
+		{"live fragments, 7 byte chunks", live, 7, []string{"styp", "moof", "mdat", "free", "moof", "mdat", "mdat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Box
+			p := NewStreamParser(func(b Box) error {
+				got = append(got, b)
+				return nil
+			})
+			for off := 0; off < len(tt.data); off += tt.chunkSize {
+				end := off + tt.chunkSize
+				if end > len(tt.data) {
+					end = len(tt.data)
+				}
+				if _, err := p.Write(tt.data[off:end]); err != nil {
+					t.Fatalf("Write() at %d error = %v", off, err)
+				}
+			}
+			if err := p.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d boxes, want %d", len(got), len(tt.want))
+			}
+			for i, b := range got {
+				if b.Type() != tt.want[i] {
+					t.Errorf("box %d: type %s, want %s", i, b.Type(), tt.want[i])
+				}
+			}
+			// boxes come out with their specific types
+			for _, b := range got {
+				switch b.Type() {
+				case "moov":
+					if mb, ok := b.(*MoovBox); !ok || len(mb.TrackBoxes) != 4 {
+						t.Errorf("moov not decoded: %T", b)
+					}
+				case "moof":
+					if mb, ok := b.(*MoofBox); !ok || mb.Mfhd == nil {
+						t.Errorf("moof not decoded: %T", b)
+					}
+				}
+			}
+		})
+	}
+
+	// a box cut off by the end of the stream is an error
+	p := NewStreamParser(func(Box) error { return nil })
+	p.Write(live[:20])
+	if err := p.Close(); err == nil {
+		t.Errorf("Close() with a partial box succeeded")
+	}
+
+	// the callback error stops the parser
+	stop := bytes.ErrTooLarge
+	p = NewStreamParser(func(Box) error { return stop })
+	if _, err := p.Write(live); err != stop {
+		t.Errorf("Write() error = %v, want callback error", err)
+	}
+}
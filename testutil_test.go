@@ -0,0 +1,140 @@
+package bmff
+
+import (
+	"encoding/binary"
+)
+
+// mkBox assembles a box of the given type around the concatenated payloads
+func mkBox(boxtype string, payloads ...[]byte) []byte {
+	var payload []byte
+	for _, p := range payloads {
+		payload = append(payload, p...)
+	}
+	b := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(b[0:4], uint32(8+len(payload)))
+	copy(b[4:8], boxtype)
+	return append(b, payload...)
+}
+
+// mkFragment builds a moof (mfhd only) and mdat pair
+func mkFragment(seq uint32, mdatLen int) []byte {
+	mfhd := make([]byte, 8)
+	binary.BigEndian.PutUint32(mfhd[4:8], seq)
+	return append(mkBox("moof", mkBox("mfhd", mfhd)), mkBox("mdat", make([]byte, mdatLen))...)
+}
+
+// mkUUIDBox assembles a uuid box of extended type u around the concatenated payloads
+func mkUUIDBox(u UUID, payloads ...[]byte) []byte {
+	return mkBox("uuid", append([][]byte{u[:]}, payloads...)...)
+}
+
+// mkStbl wraps the given sample table children in moov/trak/mdia/minf/stbl
+func mkStbl(children ...[]byte) []byte {
+	return mkBox("moov", mkBox("trak", mkBox("mdia", mkBox("minf", mkBox("stbl", children...)))))
+}
+
+// mkStsd builds a version 0 stsd holding entries
+func mkStsd(entries ...[]byte) []byte {
+	hdr := binary.BigEndian.AppendUint32(make([]byte, 4), uint32(len(entries)))
+	return mkBox("stsd", append([][]byte{hdr}, entries...)...)
+}
+
+// mkVisualEntry builds a visual sample entry of the given format followed by children
+func mkVisualEntry(format string, width, height uint16, compressor string, children ...[]byte) []byte {
+	p := make([]byte, 78)
+	p[7] = 1 // data_reference_index
+	binary.BigEndian.PutUint16(p[24:26], width)
+	binary.BigEndian.PutUint16(p[26:28], height)
+	binary.BigEndian.PutUint32(p[28:32], 72<<16)
+	binary.BigEndian.PutUint32(p[32:36], 72<<16)
+	binary.BigEndian.PutUint16(p[40:42], 1)
+	p[42] = byte(len(compressor))
+	copy(p[43:74], compressor)
+	binary.BigEndian.PutUint16(p[74:76], 0x18)
+	binary.BigEndian.PutUint16(p[76:78], 0xffff)
+	return mkBox(format, append([][]byte{p}, children...)...)
+}
+
+// mkTable builds a full box of the given version holding an entry count and pairs of
+// 32 bit values
+func mkTable(boxtype string, version byte, pairs ...uint32) []byte {
+	p := []byte{version, 0, 0, 0}
+	p = binary.BigEndian.AppendUint32(p, uint32(len(pairs)/2))
+	for _, v := range pairs {
+		p = binary.BigEndian.AppendUint32(p, v)
+	}
+	return mkBox(boxtype, p)
+}
+
+// mkProgressive builds a moov holding one sample table followed by an mdat of mdatLen
+// bytes.  stbl is called with the offset of the mdat payload.
+func mkProgressive(mdatLen int, stbl func(base uint32) [][]byte) []byte {
+	base := uint32(len(mkStbl(stbl(0)...)) + 8)
+	return append(mkStbl(stbl(base)...), mkBox("mdat", make([]byte, mdatLen))...)
+}
+
+// mkStsz builds an stsz with one size per sample
+func mkStsz(sizes ...uint32) []byte {
+	p := binary.BigEndian.AppendUint32(make([]byte, 8), uint32(len(sizes)))
+	for _, s := range sizes {
+		p = binary.BigEndian.AppendUint32(p, s)
+	}
+	return mkBox("stsz", p)
+}
+
+// mkTrak builds a moov holding one trak with an mdhd of the given timescale and a
+// sample table of children
+func mkTrak(timescale uint32, children ...[]byte) []byte {
+	return mkMinf(timescale, mkBox("stbl", children...))
+}
+
+// mkMinf builds a moov holding one trak with an mdhd of the given timescale and a
+// minf of children
+func mkMinf(timescale uint32, children ...[]byte) []byte {
+	mdhd := make([]byte, 24)
+	binary.BigEndian.PutUint32(mdhd[12:16], timescale)
+	binary.BigEndian.PutUint16(mdhd[20:22], 0x55c4) // und
+	return mkBox("moov", mkBox("trak", mkBox("mdia", mkBox("mdhd", mdhd), mkBox("minf", children...))))
+}
+
+// mkStss builds an stss of the sample numbers
+func mkStss(numbers ...uint32) []byte {
+	p := binary.BigEndian.AppendUint32(make([]byte, 4), uint32(len(numbers)))
+	for _, n := range numbers {
+		p = binary.BigEndian.AppendUint32(p, n)
+	}
+	return mkBox("stss", p)
+}
+
+// mkElst builds an elst of the given version from (duration, media time, rate) triples
+func mkElst(version byte, edits ...[3]int64) []byte {
+	p := binary.BigEndian.AppendUint32([]byte{version, 0, 0, 0}, uint32(len(edits)))
+	for _, e := range edits {
+		if version == 1 {
+			p = binary.BigEndian.AppendUint64(p, uint64(e[0]))
+			p = binary.BigEndian.AppendUint64(p, uint64(e[1]))
+		} else {
+			p = binary.BigEndian.AppendUint32(p, uint32(e[0]))
+			p = binary.BigEndian.AppendUint32(p, uint32(e[1]))
+		}
+		p = binary.BigEndian.AppendUint32(p, uint32(e[2]))
+	}
+	return mkBox("elst", p)
+}
+
+// mkEditedMovie builds a moov with an mvhd of movieTimescale and one trak holding edts,
+// an mdhd of mediaTimescale and an stts of 100 samples of 1024
+func mkEditedMovie(movieTimescale, mediaTimescale uint32, edts []byte) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:16], movieTimescale)
+	mdhd := make([]byte, 24)
+	binary.BigEndian.PutUint32(mdhd[12:16], mediaTimescale)
+	mdia := mkBox("mdia", mkBox("mdhd", mdhd), mkBox("minf", mkBox("stbl", mkTable("stts", 0, 100, 1024))))
+	return mkBox("moov", mkBox("mvhd", mvhd), mkBox("trak", edts, mdia))
+}
+
+// mkDref builds a version 0 dref holding entries
+func mkDref(entries ...[]byte) []byte {
+	hdr := binary.BigEndian.AppendUint32(make([]byte, 4), uint32(len(entries)))
+	return mkBox("dref", append([][]byte{hdr}, entries...)...)
+}
@@ -0,0 +1,290 @@
+package bmff
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Timeline gives the decode (DTS) and presentation (PTS) time of each sample of a track
+// from its stts and ctts, in the media timescale of its mdhd.  Samples are numbered
+// from 0 here, though the boxes number them from 1.
+type Timeline struct {
+	timescale uint32
+	count     int
+	duration  int64 // sum of all the sample durations
+	runs      []timeRun
+	offsets   []offsetRun // empty when there is no ctts
+	maxOrder  int         // most samples buildPTSOrder will sort
+
+	ptsOnce  sync.Once
+	ptsOrder []uint32 // sample numbers sorted by PTS, nil while PTS follows DTS order
+	ptsErr   error    // set when PTS order differs from DTS order but the track is too large to sort
+}
+
+// defaultMaxPTSOrder is the most samples SampleAtPTS sorts by PTS when the parse set no
+// limits.  Sorting keeps ptsOrderSize bytes per sample.
+const (
+	defaultMaxPTSOrder = 1 << 24
+	ptsOrderSize       = 12
+)
+
+// timeRun is one stts entry with the sample number and DTS it starts at
+type timeRun struct {
+	first int
+	count int
+	dts   int64
+	delta uint32
+}
+
+// offsetRun is one ctts entry with the sample number it starts at
+type offsetRun struct {
+	first  int
+	offset int64
+}
+
+// NewTimeline builds the timeline of the samples described by stts and ctts.  ctts may be
+// nil when composition and decoding order are the same.  ctts entries past the last sample
+// of stts are ignored, and samples past the end of ctts have no composition offset.
+func NewTimeline(stts *SttsBox, ctts *CttsBox, timescale uint32) (*Timeline, error) {
+	if timescale == 0 {
+		return nil, fmt.Errorf("%w: timescale 0", ErrBadValue)
+	}
+	t := &Timeline{timescale: timescale, maxOrder: defaultMaxPTSOrder}
+	if stts == nil {
+		return t, nil
+	}
+	var opts ParseOptions
+	if stts.box != nil {
+		opts = stts.state().opts
+	}
+	if max := opts.MaxSamplesPerRun; max > 0 && max < t.maxOrder {
+		t.maxOrder = max
+	}
+	if max := opts.MaxTotalAllocation / ptsOrderSize; max > 0 && max < int64(t.maxOrder) {
+		t.maxOrder = int(max)
+	}
+	t.runs = make([]timeRun, 0, len(stts.Entries))
+	var count uint64
+	for _, e := range stts.Entries {
+		if e.SampleCount == 0 {
+			continue
+		}
+		t.runs = append(t.runs, timeRun{first: int(count), count: int(e.SampleCount), dts: t.duration, delta: e.SampleDelta})
+		count += uint64(e.SampleCount)
+		if count > math.MaxInt || t.duration > math.MaxInt64-int64(e.SampleCount)*int64(e.SampleDelta) {
+			return nil, fmt.Errorf("%w: stts holds more samples or time than fit in an int", ErrBadValue)
+		}
+		t.duration += int64(e.SampleCount) * int64(e.SampleDelta)
+	}
+	t.count = int(count)
+	if ctts != nil {
+		n := 0
+		for _, e := range ctts.Entries {
+			if n >= t.count {
+				break
+			}
+			if e.SampleCount == 0 {
+				continue
+			}
+			t.offsets = append(t.offsets, offsetRun{first: n, offset: e.SampleOffset})
+			if uint64(e.SampleCount) >= uint64(t.count-n) {
+				n = t.count
+			} else {
+				n += int(e.SampleCount)
+			}
+		}
+		if n < t.count && len(t.offsets) > 0 {
+			t.offsets = append(t.offsets, offsetRun{first: n})
+		}
+	}
+	return t, nil
+}
+
+// SampleCount returns the number of samples on the timeline
+func (t *Timeline) SampleCount() int {
+	return t.count
+}
+
+// Timescale returns the number of time units per second
+func (t *Timeline) Timescale() uint32 {
+	return t.timescale
+}
+
+// Duration returns the sum of the sample durations, in the timescale
+func (t *Timeline) Duration() int64 {
+	return t.duration
+}
+
+// ToDuration converts time in the timescale to a time.Duration
+func (t *Timeline) ToDuration(ticks int64) time.Duration {
+	sec, rem := ticks/int64(t.timescale), ticks%int64(t.timescale)
+	return time.Duration(sec)*time.Second + time.Duration(rem)*time.Second/time.Duration(t.timescale)
+}
+
+// FromDuration converts a time.Duration to time in the timescale, rounding down
+func (t *Timeline) FromDuration(d time.Duration) int64 {
+	sec, rem := d/time.Second, d%time.Second
+	ticks := int64(sec)*int64(t.timescale) + int64(rem)*int64(t.timescale)/int64(time.Second)
+	if rem < 0 && int64(rem)*int64(t.timescale)%int64(time.Second) != 0 {
+		ticks--
+	}
+	return ticks
+}
+
+func (t *Timeline) checkSample(n int) error {
+	if n < 0 || n >= t.count {
+		return fmt.Errorf("%w: sample %d of %d", ErrBadValue, n, t.count)
+	}
+	return nil
+}
+
+// run returns the stts run holding sample n
+func (t *Timeline) run(n int) *timeRun {
+	i := sort.Search(len(t.runs), func(i int) bool { return t.runs[i].first > n }) - 1
+	return &t.runs[i]
+}
+
+// offset returns the composition offset of sample n
+func (t *Timeline) offset(n int) int64 {
+	i := sort.Search(len(t.offsets), func(i int) bool { return t.offsets[i].first > n }) - 1
+	if i < 0 {
+		return 0
+	}
+	return t.offsets[i].offset
+}
+
+// DTS returns the decode time of sample n
+func (t *Timeline) DTS(n int) (int64, error) {
+	if err := t.checkSample(n); err != nil {
+		return 0, err
+	}
+	r := t.run(n)
+	return r.dts + int64(n-r.first)*int64(r.delta), nil
+}
+
+// PTS returns the presentation time of sample n: its DTS plus its composition offset
+func (t *Timeline) PTS(n int) (int64, error) {
+	dts, err := t.DTS(n)
+	if err != nil {
+		return 0, err
+	}
+	return dts + t.offset(n), nil
+}
+
+// SampleDuration returns the duration of sample n
+func (t *Timeline) SampleDuration(n int) (uint32, error) {
+	if err := t.checkSample(n); err != nil {
+		return 0, err
+	}
+	return t.run(n).delta, nil
+}
+
+// SampleAtDTS returns the sample being decoded at time dts, the one whose decode interval
+// holds it.  Samples of zero duration are never returned.
+func (t *Timeline) SampleAtDTS(dts int64) (int, error) {
+	if dts < 0 || dts >= t.duration {
+		return 0, fmt.Errorf("%w: decode time %d outside 0..%d", ErrBadValue, dts, t.duration)
+	}
+	i := sort.Search(len(t.runs), func(i int) bool {
+		r := &t.runs[i]
+		return r.dts+int64(r.count)*int64(r.delta) > dts
+	})
+	r := &t.runs[i]
+	return r.first + int(uint64(dts-r.dts)/uint64(r.delta)), nil
+}
+
+// SampleAtPTS returns the sample on display at time pts: the one with the latest PTS
+// not after it.  Finding it in a track whose composition offsets reorder the samples
+// sorts them by PTS first, which fails with ErrLimitExceeded for tracks of more
+// samples than the parse limits (or 16M samples when there are none) allow.
+func (t *Timeline) SampleAtPTS(pts int64) (int, error) {
+	t.ptsOnce.Do(t.buildPTSOrder)
+	if t.ptsErr != nil {
+		return 0, t.ptsErr
+	}
+	if t.ptsOrder == nil {
+		// PTS grows with the sample number, search the samples directly
+		n := sort.Search(t.count, func(n int) bool {
+			p, _ := t.PTS(n)
+			return p > pts
+		}) - 1
+		if n < 0 {
+			return 0, fmt.Errorf("%w: presentation time %d before the first sample", ErrBadValue, pts)
+		}
+		return n, nil
+	}
+	i := sort.Search(len(t.ptsOrder), func(i int) bool {
+		p, _ := t.PTS(int(t.ptsOrder[i]))
+		return p > pts
+	}) - 1
+	if i < 0 {
+		return 0, fmt.Errorf("%w: presentation time %d before the first sample", ErrBadValue, pts)
+	}
+	return int(t.ptsOrder[i]), nil
+}
+
+// sampleFromPTS returns the first sample presented at or after time pts
+func (t *Timeline) sampleFromPTS(pts int64) (int, error) {
+	t.ptsOnce.Do(t.buildPTSOrder)
+	if t.ptsErr != nil {
+		return 0, t.ptsErr
+	}
+	n := t.count
+	if t.ptsOrder == nil {
+		n = sort.Search(t.count, func(n int) bool {
+			p, _ := t.PTS(n)
+			return p >= pts
+		})
+	} else if i := sort.Search(len(t.ptsOrder), func(i int) bool {
+		p, _ := t.PTS(int(t.ptsOrder[i]))
+		return p >= pts
+	}); i < len(t.ptsOrder) {
+		n = int(t.ptsOrder[i])
+	}
+	if n == t.count {
+		return 0, fmt.Errorf("%w: presentation time %d after the last sample", ErrBadValue, pts)
+	}
+	return n, nil
+}
+
+// buildPTSOrder sorts the sample numbers by PTS when composition reorders them
+func (t *Timeline) buildPTSOrder() {
+	// within an offset run PTS follows DTS, so only the run boundaries can be out of order
+	inOrder := true
+	for i := 1; i < len(t.offsets) && inOrder; i++ {
+		n := t.offsets[i].first
+		prev, _ := t.PTS(n - 1)
+		p, _ := t.PTS(n)
+		inOrder = p >= prev
+	}
+	if inOrder {
+		return
+	}
+	if t.count > t.maxOrder {
+		t.ptsErr = fmt.Errorf("%w: %d samples to sort by PTS, at most %d", ErrLimitExceeded, t.count, t.maxOrder)
+		return
+	}
+	order := make([]uint32, t.count)
+	pts := make([]int64, t.count)
+	for n := range order {
+		order[n] = uint32(n)
+		pts[n], _ = t.PTS(n)
+	}
+	sort.SliceStable(order, func(i, j int) bool { return pts[order[i]] < pts[order[j]] })
+	t.ptsOrder = order
+}
+
+// Timeline returns the timeline of the track's samples
+func (b *TrakBox) Timeline() (*Timeline, error) {
+	if b.Mdia == nil || b.Mdia.Mdhd == nil {
+		return nil, fmt.Errorf("%w: mdhd", ErrMissingBox)
+	}
+	if b.Mdia.Minf == nil || b.Mdia.Minf.Stbl == nil || b.Mdia.Minf.Stbl.Stts == nil {
+		return nil, fmt.Errorf("%w: stts", ErrMissingBox)
+	}
+	stbl := b.Mdia.Minf.Stbl
+	return NewTimeline(stbl.Stts, stbl.Ctts, b.Mdia.Mdhd.TimeScale)
+}
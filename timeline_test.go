@@ -0,0 +1,201 @@
+package bmff
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSttsCtts(t *testing.T) {
+	tests := []struct {
+		name        string
+		children    [][]byte
+		wantSamples uint64
+		wantOffsets []int64
+		wantErr     error
+	}{
+		{"stts only", [][]byte{mkTable("stts", 0, 10, 1000, 1, 500)}, 11, nil, nil},
+		{"unsigned ctts", [][]byte{mkTable("stts", 0, 3, 1000), mkTable("ctts", 0, 1, 2000, 1, 0xfffffc18)}, 3, []int64{2000, 0xfffffc18}, nil},
+		{"signed ctts", [][]byte{mkTable("stts", 0, 3, 1000), mkTable("ctts", 1, 1, 1000, 1, 0xfffffc18)}, 3, []int64{1000, -1000}, nil},
+		{"truncated stts", [][]byte{mkTable("stts", 0, 10, 1000)[:16]}, 0, nil, ErrTruncated},
+		{"entry count past the payload", [][]byte{mkBox("ctts", []byte{0, 0, 0, 0, 0x10, 0, 0, 0})}, 0, nil, ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _, err := ParseWithOptions(bytes.NewReader(mkStbl(tt.children...)), ParseOptions{Strict: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			stbl := f.Moov.TrackBoxes[0].Mdia.Minf.Stbl
+			if stbl.Stts == nil || stbl.Stts.SampleCount() != tt.wantSamples {
+				t.Fatalf("stts = %+v, want %d samples", stbl.Stts, tt.wantSamples)
+			}
+			if tt.wantOffsets == nil {
+				if stbl.Ctts != nil {
+					t.Errorf("ctts = %+v, want none", stbl.Ctts)
+				}
+				return
+			}
+			for i, want := range tt.wantOffsets {
+				if got := stbl.Ctts.Entries[i].SampleOffset; got != want {
+					t.Errorf("entry %d offset = %d, want %d", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	// IBBP style reordering at 25 fps in a 90kHz timescale: decode order I P B B P B B,
+	// presentation order I B B P B B P
+	stts := &SttsBox{Entries: []SttsEntry{{6, 3600}, {0, 100}, {1, 0}}}
+	ctts := &CttsBox{Entries: []CttsEntry{{1, 3600}, {1, 14400}, {2, 0}, {1, 10800}, {5, 0}}}
+
+	tl, err := NewTimeline(stts, ctts, 90000)
+	if err != nil {
+		t.Fatalf("NewTimeline() error = %v", err)
+	}
+	if tl.SampleCount() != 7 || tl.Duration() != 6*3600 {
+		t.Fatalf("%d samples lasting %d, want 7 lasting %d", tl.SampleCount(), tl.Duration(), 6*3600)
+	}
+	wantDTS := []int64{0, 3600, 7200, 10800, 14400, 18000, 21600}
+	wantPTS := []int64{3600, 18000, 7200, 10800, 25200, 18000, 21600}
+	for n := range wantDTS {
+		dts, err := tl.DTS(n)
+		if err != nil || dts != wantDTS[n] {
+			t.Errorf("DTS(%d) = %d, %v, want %d", n, dts, err, wantDTS[n])
+		}
+		pts, err := tl.PTS(n)
+		if err != nil || pts != wantPTS[n] {
+			t.Errorf("PTS(%d) = %d, %v, want %d", n, pts, err, wantPTS[n])
+		}
+	}
+	if d, err := tl.SampleDuration(6); err != nil || d != 0 {
+		t.Errorf("SampleDuration(6) = %d, %v, want 0", d, err)
+	}
+	if _, err := tl.DTS(7); !errors.Is(err, ErrBadValue) {
+		t.Errorf("DTS(7) error = %v, want %v", err, ErrBadValue)
+	}
+
+	lookups := []struct {
+		name    string
+		find    func(int64) (int, error)
+		time    int64
+		want    int
+		wantErr error
+	}{
+		{"DTS start", tl.SampleAtDTS, 0, 0, nil},
+		{"DTS inside a sample", tl.SampleAtDTS, 7199, 1, nil},
+		{"DTS last sample with duration", tl.SampleAtDTS, 20000, 5, nil},
+		{"DTS past the end", tl.SampleAtDTS, 21600, 0, ErrBadValue},
+		{"DTS negative", tl.SampleAtDTS, -1, 0, ErrBadValue},
+		{"PTS reordered", tl.SampleAtPTS, 7200, 2, nil},
+		{"PTS between samples", tl.SampleAtPTS, 12000, 3, nil},
+		{"PTS equal, later sample wins", tl.SampleAtPTS, 18000, 5, nil},
+		{"PTS after the last", tl.SampleAtPTS, 90000, 4, nil},
+		{"PTS before the first", tl.SampleAtPTS, 3599, 0, ErrBadValue},
+	}
+	for _, tt := range lookups {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := tt.find(tt.time)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || n != tt.want {
+				t.Errorf("sample = %d, %v, want %d", n, err, tt.want)
+			}
+		})
+	}
+
+	if d := tl.ToDuration(90000 + 45000); d != 1500*time.Millisecond {
+		t.Errorf("ToDuration() = %v", d)
+	}
+	if ticks := tl.FromDuration(-time.Millisecond / 2); ticks != -45 {
+		t.Errorf("FromDuration() = %d, want -45", ticks)
+	}
+	if _, err := NewTimeline(stts, nil, 0); !errors.Is(err, ErrBadValue) {
+		t.Errorf("NewTimeline() with timescale 0: error %v", err)
+	}
+}
+
+func TestTimelineLimits(t *testing.T) {
+	// 24 bytes of stts asking for 8 billion samples
+	huge := mkTable("stts", 0, 0xffffffff, 1, 0xffffffff, 1)
+	_, _, err := ParseWithOptions(bytes.NewReader(mkStbl(huge)), ParseOptions{Strict: true, MaxSamplesPerRun: 1 << 20})
+	if !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("huge stts with MaxSamplesPerRun: error %v, want %v", err, ErrLimitExceeded)
+	}
+
+	// without limits the timeline still answers, but will not sort that many samples by PTS
+	stts := &SttsBox{Entries: []SttsEntry{{0xffffffff, 1}, {0xffffffff, 1}}}
+	ctts := &CttsBox{Entries: []CttsEntry{{1, 2}, {1, 0}}}
+	tl, err := NewTimeline(stts, ctts, 90000)
+	if err != nil {
+		t.Fatalf("NewTimeline() error = %v", err)
+	}
+	if dts, err := tl.DTS(tl.SampleCount() - 1); err != nil || dts != 2*0xffffffff-1 {
+		t.Errorf("DTS of the last sample = %d, %v", dts, err)
+	}
+	if _, err := tl.SampleAtPTS(5); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("SampleAtPTS() of a huge reordered track: error %v, want %v", err, ErrLimitExceeded)
+	}
+	inOrder, err := NewTimeline(stts, &CttsBox{Entries: []CttsEntry{{1, 0}, {1, 1}}}, 90000)
+	if err != nil {
+		t.Fatalf("NewTimeline() error = %v", err)
+	}
+	if n, err := inOrder.SampleAtPTS(5); err != nil || n != 5 {
+		t.Errorf("SampleAtPTS() of a huge track in order = %d, %v, want 5", n, err)
+	}
+
+	long := &SttsBox{Entries: []SttsEntry{{0xffffffff, 0xffffffff}, {0xffffffff, 0xffffffff}, {0xffffffff, 0xffffffff}}}
+	if _, err := NewTimeline(long, nil, 90000); !errors.Is(err, ErrBadValue) {
+		t.Errorf("NewTimeline() with a duration past int64: error %v, want %v", err, ErrBadValue)
+	}
+}
+
+func TestTimelineFile(t *testing.T) {
+	fh, err := os.Open(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer fh.Close()
+	f, err := Parse(fh)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	trak, ok := f.FindFirst("moov/trak[hdlr=soun]").(*TrakBox)
+	if !ok {
+		t.Fatalf("no sound track")
+	}
+	tl, err := trak.Timeline()
+	if err != nil {
+		t.Fatalf("Timeline() error = %v", err)
+	}
+	if tl.Timescale() != trak.Mdia.Mdhd.TimeScale || uint64(tl.Duration()) != trak.Mdia.Mdhd.Duration {
+		t.Errorf("timescale %d duration %d, mdhd has %d and %d", tl.Timescale(), tl.Duration(),
+			trak.Mdia.Mdhd.TimeScale, trak.Mdia.Mdhd.Duration)
+	}
+	last := tl.SampleCount() - 1
+	dts, err := tl.DTS(last)
+	if err != nil {
+		t.Fatalf("DTS(%d) error = %v", last, err)
+	}
+	if n, err := tl.SampleAtPTS(dts); err != nil || n != last {
+		t.Errorf("SampleAtPTS(%d) = %d, %v, want %d", dts, n, err, last)
+	}
+	if _, err := (&TrakBox{}).Timeline(); !errors.Is(err, ErrMissingBox) {
+		t.Errorf("Timeline() of an empty trak: error %v", err)
+	}
+}
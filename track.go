@@ -0,0 +1,344 @@
+package bmff
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Track gives the samples of a trak in terms of sample numbers and times rather than
+// boxes.  Samples are numbered from 0.
+type Track struct {
+	Trak      *TrakBox
+	ID        uint32 // from tkhd
+	Kind      string // handler type from hdlr, e.g. "vide", "soun", "text"
+	Timescale uint32 // time units per second, from mdhd
+	Duration  uint64 // in Timescale, from mdhd
+	Language  string // ISO 639-2/T code from mdhd, e.g. "eng"
+	Entry     Box    // first stsd entry, e.g. *VisualSampleEntry.. nil without one
+
+	timeline *Timeline
+	table    *SampleTable
+	edits    *EditList // nil when the edit list cannot be read
+	editErr  error     // why it cannot
+	err      error     // why the samples cannot be read
+
+	resolver DataResolver
+	sources  map[uint32]*dataSource // by sample description index, for media outside the movie file
+
+	keyOnce   sync.Once
+	keyframes []keyframe // sorted by PTS
+}
+
+// keyframe is a sync sample with its presentation time
+type keyframe struct {
+	sample int
+	pts    int64
+}
+
+// newTrackInfo fills in what the trak's headers say about the track
+func newTrackInfo(trak *TrakBox) *Track {
+	t := &Track{Trak: trak}
+	if trak.Tkhd != nil {
+		t.ID = trak.Tkhd.TrackID
+	}
+	if mdia := trak.Mdia; mdia != nil {
+		if mdia.Hdlr != nil {
+			t.Kind = mdia.Hdlr.HandlerType()
+		}
+		if mdia.Mdhd != nil {
+			t.Timescale = mdia.Mdhd.TimeScale
+			t.Duration = mdia.Mdhd.Duration
+			t.Language = mdia.Mdhd.Language()
+		}
+		if mdia.Minf != nil && mdia.Minf.Stbl != nil && mdia.Minf.Stbl.Stsd != nil && len(mdia.Minf.Stbl.Stsd.Entries) > 0 {
+			t.Entry = mdia.Minf.Stbl.Stsd.Entries[0]
+		}
+	}
+	return t
+}
+
+// NewTrack builds the Track of trak, given the movie timescale of mvhd for its edit list.
+// It fails when the trak has no timing; sample tables that cannot be read are reported
+// by Err and by the Samples iterator, an edit list that cannot be read by EditList.
+func NewTrack(trak *TrakBox, movieTimescale uint32) (*Track, error) {
+	t := newTrackInfo(trak)
+	tl, err := trak.Timeline()
+	if err != nil {
+		return nil, err
+	}
+	t.timeline = tl
+	t.edits, t.editErr = trak.EditList(movieTimescale)
+	t.table, t.err = trak.SampleTable()
+	if t.err == nil && t.table.SampleCount() != tl.SampleCount() {
+		t.table, t.err = nil, fmt.Errorf("%w: %d sample sizes for %d sample times", ErrBadValue, t.table.SampleCount(), tl.SampleCount())
+	}
+	if t.err == nil {
+		t.err = t.findSources()
+	}
+	return t, nil
+}
+
+// Tracks returns the tracks of the movie in trak order.  A track whose samples cannot be
+// located in the file's mdat boxes is still returned, with Err saying why.  Samples in
+// externally referenced files are not checked.. see Track.SetDataResolver
+func (f *File_s) Tracks() []*Track {
+	if f.Moov == nil {
+		return nil
+	}
+	var movieTimescale uint32
+	if f.Moov.MovieHeader != nil {
+		movieTimescale = f.Moov.MovieHeader.TimeScale
+	}
+	var mdats []*MdatBox
+	for _, child := range f.Children() {
+		if m, ok := child.(*MdatBox); ok {
+			mdats = append(mdats, m)
+		}
+	}
+	tracks := make([]*Track, 0, len(f.Moov.TrackBoxes))
+	for _, trak := range f.Moov.TrackBoxes {
+		t, err := NewTrack(trak, movieTimescale)
+		if err != nil {
+			t = newTrackInfo(trak)
+			t.err = err
+		} else if t.err == nil {
+			t.err = t.table.validate(mdats, func(description uint32) bool { return t.sources[description] == nil })
+		}
+		tracks = append(tracks, t)
+	}
+	return tracks
+}
+
+// Err reports why the samples of the track cannot be read, nil when they can
+func (t *Track) Err() error {
+	return t.err
+}
+
+// Timeline returns the decode and presentation times of the track's samples.. nil when
+// the track has no timing
+func (t *Track) Timeline() *Timeline {
+	return t.timeline
+}
+
+// CodecConfig returns the decoder configuration box of the first sample entry, an
+// *AvcCBox, *HvcCBox or *EsdsBox, or nil when there is none
+func (t *Track) CodecConfig() Box {
+	switch e := t.Entry.(type) {
+	case *VisualSampleEntry:
+		switch {
+		case e.AvcC != nil:
+			return e.AvcC
+		case e.HvcC != nil:
+			return e.HvcC
+		case e.Esds != nil:
+			return e.Esds
+		}
+	case *AudioSampleEntry:
+		if e.Esds != nil {
+			return e.Esds
+		}
+	case *SampleEntry:
+		if e.Esds != nil {
+			return e.Esds
+		}
+	}
+	return nil
+}
+
+func (t *Track) stbl() *StblBox {
+	return t.Trak.Mdia.Minf.Stbl
+}
+
+// IsSync reports whether sample n is a random access point
+func (t *Track) IsSync(n int) bool {
+	if t.timeline == nil || n < 0 || n >= t.timeline.SampleCount() {
+		return false
+	}
+	stss := t.stbl().Stss
+	if stss == nil {
+		return true
+	}
+	i := sort.Search(len(stss.SampleNumbers), func(i int) bool { return stss.SampleNumbers[i] >= uint32(n+1) })
+	return i < len(stss.SampleNumbers) && stss.SampleNumbers[i] == uint32(n+1)
+}
+
+// SampleDependency returns the sdtp entry of sample n, if the track has one
+func (t *Track) SampleDependency(n int) (SdtpEntry, bool) {
+	if t.timeline == nil {
+		return SdtpEntry{}, false
+	}
+	sdtp := t.stbl().Sdtp
+	if sdtp == nil || n < 0 || n >= len(sdtp.Entries) {
+		return SdtpEntry{}, false
+	}
+	return sdtp.Entries[n], true
+}
+
+// Keyframes returns the numbers of the random access samples in decode order.  When the
+// track has no stss every sample is one: all is set and keys is nil.
+func (t *Track) Keyframes() (keys []int, all bool) {
+	if t.timeline == nil {
+		return nil, false
+	}
+	count := t.timeline.SampleCount()
+	stss := t.stbl().Stss
+	if stss == nil {
+		return nil, true
+	}
+	keys = make([]int, 0, len(stss.SampleNumbers))
+	for _, num := range stss.SampleNumbers {
+		if num == 0 || int64(num) > int64(count) {
+			continue // not a sample of the track
+		}
+		keys = append(keys, int(num-1))
+	}
+	return keys, false
+}
+
+// NearestKeyframe returns the random access sample presented closest to t: the last one
+// at or before t when before is set, otherwise the first one at or after t
+func (t *Track) NearestKeyframe(at time.Duration, before bool) (int, error) {
+	if t.timeline == nil {
+		return 0, t.err
+	}
+	if t.stbl().Stss == nil {
+		// every sample is a keyframe.. search the timeline rather than list them all
+		ticks := t.timeline.FromDuration(at)
+		if before {
+			return t.timeline.SampleAtPTS(ticks)
+		}
+		if t.timeline.ToDuration(ticks) != at {
+			ticks++
+		}
+		return t.timeline.sampleFromPTS(ticks)
+	}
+	t.keyOnce.Do(t.buildKeyframes)
+	keys := t.keyframes
+	i := sort.Search(len(keys), func(i int) bool { return t.timeline.ToDuration(keys[i].pts) > at })
+	if before {
+		if i == 0 {
+			return 0, fmt.Errorf("%w: no keyframe at or before %v", ErrBadValue, at)
+		}
+		return keys[i-1].sample, nil
+	}
+	if i > 0 && t.timeline.ToDuration(keys[i-1].pts) == at {
+		return keys[i-1].sample, nil
+	}
+	if i == len(keys) {
+		return 0, fmt.Errorf("%w: no keyframe at or after %v", ErrBadValue, at)
+	}
+	return keys[i].sample, nil
+}
+
+// buildKeyframes sorts the keyframes by presentation time
+func (t *Track) buildKeyframes() {
+	keys, _ := t.Keyframes()
+	for _, n := range keys {
+		pts, _ := t.timeline.PTS(n)
+		t.keyframes = append(t.keyframes, keyframe{sample: n, pts: pts})
+	}
+	sort.SliceStable(t.keyframes, func(i, j int) bool { return t.keyframes[i].pts < t.keyframes[j].pts })
+}
+
+// *********************************************************
+
+// Sample is one sample of a track, with its times in the track's timescale
+type Sample struct {
+	Index    int // numbered from 0 in decode order
+	DTS      int64
+	PTS      int64
+	Duration uint32
+	Offset   int64 // of the sample data from the start of the file holding it
+	Size     uint32
+	IsSync   bool
+
+	src *dataSource // nil when the sample is in the movie file
+}
+
+// Data reads the sample's bytes from r, the file the track was parsed from, or from the
+// file the track's DataResolver opens for samples stored outside it
+func (s *Sample) Data(r io.ReaderAt) ([]byte, error) {
+	if s.src != nil {
+		var err error
+		if r, err = s.src.reader(); err != nil {
+			return nil, fmt.Errorf("sample %d: %w", s.Index, err)
+		}
+	}
+	// read in steps, so a corrupt size allocates no more than r holds
+	buf, err := readPayload(io.NewSectionReader(r, s.Offset, int64(s.Size)), int64(s.Size))
+	if err == nil {
+		return buf, nil
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = ErrTruncated
+	}
+	return nil, fmt.Errorf("sample %d at offset %d: %w", s.Index, s.Offset, err)
+}
+
+// SampleIter steps through the samples of a track in decode order:
+//
+//	it := track.Samples()
+//	for it.Next() {
+//		s := it.Sample()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type SampleIter struct {
+	t      *Track
+	next   int
+	sample Sample
+	err    error
+}
+
+// Samples returns an iterator over the track's samples
+func (t *Track) Samples() *SampleIter {
+	it := &SampleIter{t: t, err: t.err}
+	if it.err == nil && (t.timeline == nil || t.table == nil) {
+		it.err = fmt.Errorf("%w: sample table of track %d", ErrMissingBox, t.ID)
+	}
+	return it
+}
+
+// Next advances to the next sample and reports whether there is one
+func (it *SampleIter) Next() bool {
+	if it.err != nil || it.next >= it.t.timeline.SampleCount() {
+		return false
+	}
+	n := it.next
+	s := Sample{Index: n, IsSync: it.t.IsSync(n)}
+	var err error
+	if s.DTS, err = it.t.timeline.DTS(n); err == nil {
+		s.PTS, err = it.t.timeline.PTS(n)
+	}
+	if err == nil {
+		s.Duration, err = it.t.timeline.SampleDuration(n)
+	}
+	var loc SampleLocation
+	if err == nil {
+		loc, err = it.t.table.Locate(n)
+	}
+	if err != nil {
+		it.err = err
+		return false
+	}
+	s.Offset, s.Size = loc.Offset, loc.Size
+	s.src = it.t.sources[loc.DescriptionIndex]
+	it.sample = s
+	it.next++
+	return true
+}
+
+// Sample returns the sample Next advanced to
+func (it *SampleIter) Sample() Sample {
+	return it.sample
+}
+
+// Err returns the error that ended the iteration, nil when every sample was visited
+func (it *SampleIter) Err() error {
+	return it.err
+}
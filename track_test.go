@@ -0,0 +1,284 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKeyframes(t *testing.T) {
+	// ten samples of 100ms, the second and fifth presented 200ms late
+	stts := mkTable("stts", 0, 10, 1000)
+	ctts := mkTable("ctts", 0, 1, 1000, 1, 2000, 2, 1000, 1, 3000, 5, 1000)
+	sdtp := mkBox("sdtp", []byte{0, 0, 0, 0, 0x20, 0x18, 0x18, 0x24, 0x18, 0x18, 0x18, 0x20, 0x18, 0xd8})
+
+	tests := []struct {
+		name          string
+		data          []byte
+		wantKeyframes []int
+		wantAll       bool
+		wantErr       error
+	}{
+		{"stss", mkTrak(10000, stts, mkStss(1, 4, 8), sdtp), []int{0, 3, 7}, false, nil},
+		{"reordered", mkTrak(10000, stts, ctts, mkStss(1, 2, 5, 8)), []int{0, 1, 4, 7}, false, nil},
+		{"every sample without stss", mkTrak(10000, stts), nil, true, nil},
+		{"stss past the last sample", mkTrak(10000, stts, mkStss(1, 11)), []int{0}, false, nil},
+		{"stss out of order", mkTrak(10000, stts, mkStss(4, 1)), nil, false, ErrBadValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, _, err := ParseWithOptions(bytes.NewReader(tt.data), ParseOptions{Strict: true})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseWithOptions() error = %v", err)
+			}
+			track, err := NewTrack(f.Moov.TrackBoxes[0], 0)
+			if err != nil {
+				t.Fatalf("NewTrack() error = %v", err)
+			}
+			if keys, all := track.Keyframes(); !reflect.DeepEqual(keys, tt.wantKeyframes) || all != tt.wantAll {
+				t.Errorf("Keyframes() = %v, %v, want %v, %v", keys, all, tt.wantKeyframes, tt.wantAll)
+			}
+			for n := 0; n < 10; n++ {
+				want := tt.wantAll
+				for _, k := range tt.wantKeyframes {
+					want = want || k == n
+				}
+				if track.IsSync(n) != want {
+					t.Errorf("IsSync(%d) = %v, want %v", n, !want, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNearestKeyframe(t *testing.T) {
+	stts := mkTable("stts", 0, 10, 1000)
+	ctts := mkTable("ctts", 0, 1, 1000, 1, 2000, 2, 1000, 1, 3000, 5, 1000)
+	sdtp := mkBox("sdtp", []byte{0, 0, 0, 0, 0x20, 0x18, 0x18, 0x24, 0x18, 0x18, 0x18, 0x20, 0x18, 0xd8})
+	f, _, err := ParseWithOptions(bytes.NewReader(mkTrak(10000, stts, ctts, mkStss(1, 4, 5, 8), sdtp)), ParseOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions() error = %v", err)
+	}
+	track, err := NewTrack(f.Moov.TrackBoxes[0], 0)
+	if err != nil {
+		t.Fatalf("NewTrack() error = %v", err)
+	}
+
+	// keyframes presented at 100ms (0), 400ms (3), 700ms (4) and 800ms (7)
+	tests := []struct {
+		name    string
+		at      time.Duration
+		before  bool
+		want    int
+		wantErr error
+	}{
+		{"before, on a keyframe", 400 * time.Millisecond, true, 3, nil},
+		{"after, on a keyframe", 400 * time.Millisecond, false, 3, nil},
+		{"before, between", 650 * time.Millisecond, true, 3, nil},
+		{"after, between", 650 * time.Millisecond, false, 4, nil},
+		{"before, reordered", 750 * time.Millisecond, true, 4, nil},
+		{"after the last", time.Second, true, 7, nil},
+		{"before the first", 50 * time.Millisecond, true, 0, ErrBadValue},
+		{"nothing after", 801 * time.Millisecond, false, 0, ErrBadValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := track.NearestKeyframe(tt.at, tt.before)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || n != tt.want {
+				t.Errorf("NearestKeyframe(%v, %v) = %d, %v, want %d", tt.at, tt.before, n, err, tt.want)
+			}
+		})
+	}
+
+	dep, ok := track.SampleDependency(3)
+	if !ok || dep != (SdtpEntry{IsLeading: 0, DependsOn: 2, IsDependedOn: 1, HasRedundancy: 0}) {
+		t.Errorf("SampleDependency(3) = %+v, %v", dep, ok)
+	}
+	if dep, ok := track.SampleDependency(9); !ok || dep != (SdtpEntry{IsLeading: 3, DependsOn: 1, IsDependedOn: 2, HasRedundancy: 0}) {
+		t.Errorf("SampleDependency(9) = %+v, %v", dep, ok)
+	}
+	if _, ok := track.SampleDependency(10); ok {
+		t.Errorf("SampleDependency(10) found an entry")
+	}
+}
+
+func TestNearestKeyframeWithoutStss(t *testing.T) {
+	// every sample is a keyframe: ten samples of 100ms, the second presented after the third
+	stts := mkTable("stts", 0, 10, 1000)
+	ctts := mkTable("ctts", 0, 1, 1000, 1, 2500, 8, 1000)
+	// 8 billion samples of 1 tick from a 24 byte stts.. there is nothing to list or sort
+	huge := mkTable("stts", 0, 0xffffffff, 1, 0xffffffff, 1)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		at      time.Duration
+		before  bool
+		want    int
+		wantErr error
+	}{
+		{"before, on a sample", mkTrak(10000, stts, ctts), 300 * time.Millisecond, true, 2, nil},
+		{"before, reordered", mkTrak(10000, stts, ctts), 360 * time.Millisecond, true, 1, nil},
+		{"after, between", mkTrak(10000, stts, ctts), 250 * time.Millisecond, false, 2, nil},
+		{"after, reordered", mkTrak(10000, stts, ctts), 320 * time.Millisecond, false, 1, nil},
+		{"before the first", mkTrak(10000, stts, ctts), 50 * time.Millisecond, true, 0, ErrBadValue},
+		{"nothing after", mkTrak(10000, stts, ctts), 1001 * time.Millisecond, false, 0, ErrBadValue},
+		{"huge, before", mkTrak(10000, huge), time.Hour, true, 36000000, nil},
+		{"huge, after", mkTrak(10000, huge), time.Hour + 50*time.Microsecond, false, 36000001, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			track, err := NewTrack(f.Moov.TrackBoxes[0], 0)
+			if err != nil {
+				t.Fatalf("NewTrack() error = %v", err)
+			}
+			n, err := track.NearestKeyframe(tt.at, tt.before)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || n != tt.want {
+				t.Errorf("NearestKeyframe(%v, %v) = %d, %v, want %d", tt.at, tt.before, n, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSamples(t *testing.T) {
+	payload := []byte("aaaabbcccccc")
+	stbl := func(base uint32) [][]byte {
+		return [][]byte{mkTable("stts", 0, 2, 512, 1, 1024), mkTable("ctts", 0, 1, 1024, 2, 0), mkStss(1),
+			mkBox("stsc", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 3, 0, 0, 0, 1}), mkStsz(4, 2, 6),
+			mkBox("stco", binary.BigEndian.AppendUint32([]byte{0, 0, 0, 0, 0, 0, 0, 1}, base))}
+	}
+	base := uint32(len(mkTrak(12800, stbl(0)...)) + 8)
+	data := append(mkTrak(12800, stbl(base)...), mkBox("mdat", payload)...)
+
+	f, _, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions() error = %v", err)
+	}
+	tracks := f.Tracks()
+	if len(tracks) != 1 || tracks[0].Err() != nil {
+		t.Fatalf("Tracks() = %+v", tracks)
+	}
+	track := tracks[0]
+	if track.Timescale != 12800 || track.Language != "und" {
+		t.Errorf("timescale %d language %q, want 12800 und", track.Timescale, track.Language)
+	}
+
+	want := []struct {
+		sample Sample
+		data   string
+	}{
+		{Sample{Index: 0, DTS: 0, PTS: 1024, Duration: 512, Size: 4, IsSync: true}, "aaaa"},
+		{Sample{Index: 1, DTS: 512, PTS: 512, Duration: 512, Offset: 4, Size: 2}, "bb"},
+		{Sample{Index: 2, DTS: 1024, PTS: 1024, Duration: 1024, Offset: 6, Size: 6}, "cccccc"},
+	}
+	it := track.Samples()
+	for i := 0; it.Next(); i++ {
+		s := it.Sample()
+		if i >= len(want) {
+			t.Fatalf("sample %d is past the last one", i)
+		}
+		got := s
+		got.Offset -= int64(base)
+		if got != want[i].sample {
+			t.Errorf("sample %d = %+v, want %+v", i, got, want[i].sample)
+		}
+		b, err := s.Data(bytes.NewReader(data))
+		if err != nil || string(b) != want[i].data {
+			t.Errorf("sample %d Data() = %q, %v, want %q", i, b, err, want[i].data)
+		}
+		if _, err := s.Data(bytes.NewReader(data[:len(data)-1])); i == 2 && !errors.Is(err, ErrTruncated) {
+			t.Errorf("sample %d Data() of a cut file: error %v, want %v", i, err, ErrTruncated)
+		}
+		// a forged size is read no further than the file goes
+		s.Size = 0xffffffff
+		if _, err := s.Data(bytes.NewReader(data)); !errors.Is(err, ErrTruncated) {
+			t.Errorf("sample %d Data() with a 4GB size: error %v, want %v", i, err, ErrTruncated)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("Err() = %v", err)
+	}
+
+	// a chunk offset past the mdat leaves the track without samples
+	bad := append(mkTrak(12800, stbl(base+100)...), mkBox("mdat", payload)...)
+	f, _, err = ParseWithOptions(bytes.NewReader(bad), ParseOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("ParseWithOptions() error = %v", err)
+	}
+	track = f.Tracks()[0]
+	if it := track.Samples(); it.Next() || !errors.Is(it.Err(), ErrBadValue) || !errors.Is(track.Err(), ErrBadValue) {
+		t.Errorf("Samples() of a bad track: error %v", it.Err())
+	}
+}
+
+func TestTracksFile(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to read test file: %v", err)
+	}
+	f, err := Parse(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	tracks := f.Tracks()
+	wantKinds := []string{"sdsm", "odsm", "vide", "soun"}
+	if len(tracks) != len(wantKinds) {
+		t.Fatalf("%d tracks, want %d", len(tracks), len(wantKinds))
+	}
+	for i, track := range tracks {
+		if track.Kind != wantKinds[i] || track.ID != f.Moov.TrackBoxes[i].Tkhd.TrackID || track.Err() != nil {
+			t.Errorf("track %d: kind %q id %d error %v", i, track.Kind, track.ID, track.Err())
+		}
+		var dts int64
+		count := 0
+		it := track.Samples()
+		for it.Next() {
+			s := it.Sample()
+			if s.DTS != dts {
+				t.Errorf("track %d sample %d: DTS %d, want %d", track.ID, s.Index, s.DTS, dts)
+			}
+			dts += int64(s.Duration)
+			if _, err := s.Data(bytes.NewReader(data)); err != nil {
+				t.Errorf("track %d sample %d: Data() error = %v", track.ID, s.Index, err)
+			}
+			count++
+		}
+		if it.Err() != nil || count != track.Timeline().SampleCount() || uint64(dts) != track.Duration {
+			t.Errorf("track %d: %d samples lasting %d, error %v.. want %d lasting %d", track.ID, count, dts, it.Err(),
+				track.Timeline().SampleCount(), track.Duration)
+		}
+	}
+	if _, ok := tracks[2].CodecConfig().(*EsdsBox); !ok {
+		t.Errorf("video CodecConfig() = %T, want *EsdsBox", tracks[2].CodecConfig())
+	}
+	if _, ok := tracks[3].Entry.(*AudioSampleEntry); !ok {
+		t.Errorf("audio Entry = %T, want *AudioSampleEntry", tracks[3].Entry)
+	}
+}
@@ -0,0 +1,73 @@
+package bmff
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// UUID is the 16 byte extended type carried by 'uuid' boxes
+type UUID [16]byte
+
+// extended types decoded by this package
+var (
+	UUIDTfxd     = MustParseUUID("6d1d9b05-42d5-44e6-80e2-141daff757b2") // Smooth Streaming fragment time
+	UUIDTfrf     = MustParseUUID("d4807ef2-ca39-4695-8e54-26cb9e46a79f") // Smooth Streaming following fragments
+	UUIDPiffSenc = MustParseUUID("a2394f52-5a9b-4f14-a244-6c427c648df4") // PIFF sample encryption
+	UUIDXMP      = MustParseUUID("be7acfcb-97a9-42e8-9c71-999491e3afac") // XMP metadata
+)
+
+// names shown by PrintDetail for well known extended types
+var uuidNames = map[UUID]string{
+	UUIDTfxd:     "tfxd",
+	UUIDTfrf:     "tfrf",
+	UUIDPiffSenc: "senc",
+	UUIDXMP:      "XMP_",
+}
+
+// ParseUUID reads a UUID in the canonical hex form, e.g. "a2394f52-5a9b-4f14-a244-6c427c648df4".
+// Dashes are optional and either case is accepted.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	raw, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(raw) != len(u) {
+		return u, fmt.Errorf("bmff: bad UUID %q", s)
+	}
+	copy(u[:], raw)
+	return u, nil
+}
+
+// MustParseUUID is ParseUUID for constants.. it panics on a malformed string
+func MustParseUUID(s string) UUID {
+	u, err := ParseUUID(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// String returns the canonical lower case form, e.g. "a2394f52-5a9b-4f14-a244-6c427c648df4"
+func (u UUID) String() string {
+	h := hex.EncodeToString(u[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// ExtendedType returns the extended type of a 'uuid' box.  ok is false for other boxes.
+func (b *box) ExtendedType() (u UUID, ok bool) {
+	if b.boxtype != "uuid" || len(b.usertype) != len(u) {
+		return u, false
+	}
+	copy(u[:], b.usertype)
+	return u, true
+}
+
+// displayType is the type PrintDetail shows: the box type, with the name of a well
+// known extended type added for uuid boxes
+func (b *box) displayType() string {
+	if u, ok := b.ExtendedType(); ok {
+		if name, known := uuidNames[u]; known {
+			return "uuid:" + name
+		}
+	}
+	return b.boxtype
+}
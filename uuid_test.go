@@ -0,0 +1,106 @@
+package bmff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestUUID(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"a2394f52-5a9b-4f14-a244-6c427c648df4", "a2394f52-5a9b-4f14-a244-6c427c648df4", false},
+		{"A2394F525A9B4F14A2446C427C648DF4", "a2394f52-5a9b-4f14-a244-6c427c648df4", false},
+		{"a2394f52-5a9b-4f14-a244", "", true},
+		{"not a uuid at all, not at all!!!", "", true},
+	}
+	for _, tt := range tests {
+		u, err := ParseUUID(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseUUID(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && u.String() != tt.want {
+			t.Errorf("ParseUUID(%q) = %s, want %s", tt.in, u, tt.want)
+		}
+	}
+}
+
+func TestUUIDBoxes(t *testing.T) {
+	tfhd := make([]byte, 8)
+	tfxd := make([]byte, 20)
+	tfxd[0] = 1 // version 1.. 64 bit times
+	binary.BigEndian.PutUint64(tfxd[4:12], 900000000)
+	binary.BigEndian.PutUint64(tfxd[12:20], 20000000)
+	tfrf := []byte{1, 0, 0, 0, 2}
+	for _, v := range []uint64{920000000, 20000000, 940000000, 20000000} {
+		tfrf = binary.BigEndian.AppendUint64(tfrf, v)
+	}
+	// subsample encryption, 8 byte IVs: one sample with 2 subsamples, one with none
+	senc := []byte{0, 0, 0, 2, 0, 0, 0, 2}
+	senc = append(senc, 1, 2, 3, 4, 5, 6, 7, 8, 0, 2, 0, 16, 0, 0, 1, 0, 0, 32, 0, 0, 2, 0)
+	senc = append(senc, 8, 7, 6, 5, 4, 3, 2, 1, 0, 0)
+	xmp := []byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`)
+
+	var data []byte
+	data = append(data, mkUUIDBox(UUIDXMP, xmp)...)
+	data = append(data, mkBox("moof", mkBox("mfhd", make([]byte, 8)), mkBox("traf", mkBox("tfhd", tfhd),
+		mkUUIDBox(UUIDTfxd, tfxd), mkUUIDBox(UUIDTfrf, tfrf), mkUUIDBox(UUIDPiffSenc, senc)))...)
+
+	f, diags, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{Strict: true})
+	if err != nil || len(diags) != 0 {
+		t.Fatalf("ParseWithOptions() error = %v, diagnostics %v", err, diags)
+	}
+	if x, ok := f.subBox[0].(*XmpBox); !ok || x.Packet != string(xmp) {
+		t.Errorf("top level XMP decoded as %T", f.subBox[0])
+	}
+	traf := f.Moof.Traf[0]
+	if traf.Tfxd == nil || traf.Tfxd.FragmentAbsoluteTime != 900000000 || traf.Tfxd.FragmentDuration != 20000000 {
+		t.Errorf("tfxd = %+v", traf.Tfxd)
+	}
+	if traf.Tfrf == nil || len(traf.Tfrf.Entries) != 2 || traf.Tfrf.Entries[1].FragmentAbsoluteTime != 940000000 {
+		t.Errorf("tfrf = %+v", traf.Tfrf)
+	}
+	if s := traf.Senc; s == nil || len(s.Samples) != 2 || len(s.Samples[0].Subsamples) != 2 ||
+		s.Samples[0].Subsamples[1].BytesOfProtectedData != 0x200 || s.Samples[1].IV[0] != 8 {
+		t.Errorf("senc = %+v", traf.Senc)
+	}
+	if u, ok := traf.Tfxd.ExtendedType(); !ok || u != UUIDTfxd || traf.Tfxd.displayType() != "uuid:tfxd" {
+		t.Errorf("tfxd extended type = %s, shown as %s", u, traf.Tfxd.displayType())
+	}
+	if _, ok := traf.Tfhd.ExtendedType(); ok {
+		t.Errorf("tfhd reports an extended type")
+	}
+
+	// decoded uuid boxes still write back out unchanged
+	var out bytes.Buffer
+	if _, err := f.Output(&out, 6); err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("Output() mismatch, err = %v", err)
+	}
+}
+
+func TestPiffSencBadCounts(t *testing.T) {
+	tests := []struct {
+		name string
+		senc []byte
+		want error
+	}{
+		// flags 0x000001 with a 0 byte IV and no subsamples: every record is empty
+		{"forged count of empty records", append([]byte{0, 0, 0, 1, 0, 0, 1, 0}, append(make([]byte, 16), 0xff, 0xff, 0xff, 0xff)...), ErrTruncated},
+		{"IV size 4", append([]byte{0, 0, 0, 1, 0, 0, 1, 4}, append(make([]byte, 16), 0, 0, 0, 1, 1, 2, 3, 4)...), ErrBadValue},
+		{"forged count with subsamples", []byte{0, 0, 0, 2, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := mkBox("moof", mkBox("traf", mkUUIDBox(UUIDPiffSenc, tt.senc)))
+			_, _, err := ParseWithOptions(bytes.NewReader(data), ParseOptions{Strict: true})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("ParseWithOptions() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
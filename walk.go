@@ -0,0 +1,47 @@
+package bmff
+
+import "errors"
+
+var (
+	// SkipChildren returned by a Walk function skips the boxes below the current one
+	SkipChildren = errors.New("bmff: skip children")
+	// Stop returned by a Walk function ends the walk without error
+	Stop = errors.New("bmff: stop walk")
+)
+
+// Walk calls fn for root and then every box below it, depth first in file order.
+// path holds the ancestors of b starting with root (empty for root itself); it is
+// reused between calls so copy it to keep it.
+// Walk keeps no state in the boxes, so any number of walks may run over the same
+// tree at once, and a tree edited between walks is always traversed completely.
+func Walk(root Box, fn func(path []Box, b Box) error) error {
+	if err := walk(nil, root, fn); err != nil && err != Stop {
+		return err
+	}
+	return nil
+}
+
+func walk(path []Box, b Box, fn func(path []Box, b Box) error) error {
+	switch err := fn(path, b); err {
+	case nil:
+	case SkipChildren:
+		return nil
+	default:
+		return err
+	}
+	path = append(path, b)
+	for _, c := range b.Children() {
+		if err := walk(path, c, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printTree prints the detail line of root and everything below it
+func printTree(root Box) {
+	Walk(root, func(_ []Box, b Box) error {
+		b.PrintDetail()
+		return nil
+	})
+}
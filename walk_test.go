@@ -0,0 +1,108 @@
+package bmff
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWalk(t *testing.T) {
+	rF, err := os.Open(filepath.Join("testdata", "01_simple.mp4"))
+	if err != nil {
+		t.Fatalf("failed to open test file: %v", err)
+	}
+	defer rF.Close()
+	f, err := Parse(rF)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	// full walk in file order, with the ancestors of every box
+	var order []string
+	Walk(f, func(path []Box, b Box) error {
+		if b.Type() == "stbl" {
+			var types []string
+			for _, p := range path[1:] {
+				types = append(types, p.Type())
+			}
+			order = append(order, strings.Join(types, "/"))
+		}
+		return nil
+	})
+	if len(order) != 4 || order[0] != "moov/trak/mdia/minf" {
+		t.Errorf("stbl paths = %v", order)
+	}
+
+	// SkipChildren prunes, Stop ends the walk early without an error
+	count := 0
+	err = Walk(f, func(path []Box, b Box) error {
+		count++
+		if b.Type() == "trak" {
+			return SkipChildren
+		}
+		return nil
+	})
+	if err != nil || count != 1+4+7+1 { // file.. ftyp moov mdat free.. mvhd iods 4*trak udta.. cprt
+		t.Errorf("walk with SkipChildren visited %d boxes, err = %v", count, err)
+	}
+	count = 0
+	err = Walk(f, func(path []Box, b Box) error {
+		if count++; count == 3 {
+			return Stop
+		}
+		return nil
+	})
+	if err != nil || count != 3 {
+		t.Errorf("walk with Stop visited %d boxes, err = %v", count, err)
+	}
+	boom := errors.New("boom")
+	if err := Walk(f, func([]Box, Box) error { return boom }); err != boom {
+		t.Errorf("Walk() error = %v, want %v", err, boom)
+	}
+
+	// walks are re-entrant
+	var wg sync.WaitGroup
+	counts := make([]int, 8)
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			Walk(f.Moov, func([]Box, Box) error {
+				counts[i]++
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+	for i := range counts {
+		if counts[i] != counts[0] || counts[0] < 40 {
+			t.Errorf("concurrent walk %d visited %d boxes", i, counts[i])
+		}
+	}
+}
+
+func TestInsertSubBoxCursor(t *testing.T) {
+	f, err := Parse(strings.NewReader(string(append(mkBox("styp", make([]byte, 8)), mkFragment(1, 4)...))))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	e := NewEmsgBox(f.Tag, "uri", "v", 1, 2, 3, 4, "")
+	e.Encode()
+	if err := f.InsertEmsg(e); err != nil {
+		t.Fatalf("InsertEmsg() error = %v", err)
+	}
+	var types []string
+	f.ResetSubBox()
+	for b, err := f.GetSubBox(); err == nil; b, err = f.GetSubBox() {
+		types = append(types, b.Type())
+	}
+	if got := strings.Join(types, ","); got != "styp,emsg,moof,mdat" {
+		t.Errorf("GetSubBox() after insert = %s", got)
+	}
+	if len(f.Children()) != 4 || len(f.Fragments[0].Emsg) != 1 {
+		t.Errorf("Children() = %d boxes, fragment emsgs = %d", len(f.Children()), len(f.Fragments[0].Emsg))
+	}
+}